@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+
+	"RedisShake/internal/checker"
+	"RedisShake/internal/log"
+	"RedisShake/internal/reader"
+	"RedisShake/internal/writer"
+
+	"github.com/mcuadros/go-defaults"
+	"github.com/spf13/viper"
+)
+
+// runCheck compares the source of the reader with the target of the writer
+// instead of syncing them. It returns the number of mismatched keys.
+func runCheck(ctx context.Context, v *viper.Viper) int {
+	src := new(checker.EndpointOptions)
+	switch {
+	case v.IsSet("sync_reader"):
+		opts := new(reader.SyncReaderOptions)
+		defaults.SetDefaults(opts)
+		err := v.UnmarshalKey("sync_reader", opts)
+		if err != nil {
+			log.Panicf("failed to read the SyncReader config entry. err: %v", err)
+		}
+		src.Cluster, src.Address, src.Username, src.Password, src.Tls, src.PreferReplica =
+			opts.Cluster, opts.Address, opts.Username, opts.Password, opts.Tls, opts.PreferReplica
+	case v.IsSet("scan_reader"):
+		opts := new(reader.ScanReaderOptions)
+		defaults.SetDefaults(opts)
+		err := v.UnmarshalKey("scan_reader", opts)
+		if err != nil {
+			log.Panicf("failed to read the ScanReader config entry. err: %v", err)
+		}
+		src.Cluster, src.Address, src.Username, src.Password, src.Tls, src.PreferReplica =
+			opts.Cluster, opts.Address, opts.Username, opts.Password, opts.Tls, opts.PreferReplica
+		src.DBS = opts.DBS
+	default:
+		log.Panicf("check mode only supports sync_reader and scan_reader")
+	}
+
+	if !v.IsSet("redis_writer") {
+		log.Panicf("check mode only supports redis_writer")
+	}
+	opts := new(writer.RedisWriterOptions)
+	defaults.SetDefaults(opts)
+	err := v.UnmarshalKey("redis_writer", opts)
+	if err != nil {
+		log.Panicf("failed to read the RedisWriter config entry. err: %v", err)
+	}
+	if opts.Sentinel {
+		log.Panicf("check mode does not support sentinel, set the address of the master instead")
+	}
+	dst := &checker.EndpointOptions{
+		Cluster:  opts.Cluster,
+		Address:  opts.Address,
+		Username: opts.Username,
+		Password: opts.Password,
+		Tls:      opts.Tls,
+		DBS:      src.DBS,
+	}
+	return checker.NewChecker(ctx, src, dst).Run()
+}
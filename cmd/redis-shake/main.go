@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	_ "net/http/pprof"
 	"os"
 	"os/signal"
@@ -10,11 +11,14 @@ import (
 	"time"
 
 	"RedisShake/internal/config"
+	"RedisShake/internal/control"
 	"RedisShake/internal/entry"
 	"RedisShake/internal/filter"
+	"RedisShake/internal/hook"
 	"RedisShake/internal/log"
 	"RedisShake/internal/reader"
 	"RedisShake/internal/status"
+	"RedisShake/internal/transform"
 	"RedisShake/internal/utils"
 	"RedisShake/internal/writer"
 
@@ -24,14 +28,54 @@ import (
 func main() {
 	v := config.LoadConfig()
 
-	log.Init(config.Opt.Advanced.LogLevel, config.Opt.Advanced.LogFile, config.Opt.Advanced.Dir)
+	log.Init(log.Options{
+		Level:          config.Opt.Advanced.LogLevel,
+		Levels:         config.Opt.Advanced.LogLevels,
+		Format:         config.Opt.Advanced.LogFormat,
+		Dir:            config.Opt.Advanced.Dir,
+		File:           config.Opt.Advanced.LogFile,
+		MaxSize:        config.Opt.Advanced.LogMaxSize,
+		RotateInterval: config.Opt.Advanced.LogRotateInterval,
+		MaxBackups:     config.Opt.Advanced.LogMaxBackups,
+		MaxAge:         config.Opt.Advanced.LogMaxAge,
+	})
+	if config.Opt.Filter.FunctionFile != "" {
+		// resolve the path before changing dir
+		config.Opt.Filter.FunctionFile = utils.GetAbsPath(config.Opt.Filter.FunctionFile)
+	}
 	utils.ChdirAndAcquireFileLock()
 	utils.SetNcpu()
 	utils.SetPprofPort()
-	luaRuntime := filter.NewFunctionFilter(config.Opt.Filter.Function)
+	filter.Init()
+	transform.Init()
+	hook.Init()
+	var luaRuntime *filter.Runtime
+	if config.Opt.Filter.FunctionFile != "" {
+		if config.Opt.Filter.Function != "" {
+			log.Panicf("function and function_file can not be set at the same time")
+		}
+		luaRuntime = filter.NewFunctionFilterFromFile(config.Opt.Filter.FunctionFile)
+	} else {
+		luaRuntime = filter.NewFunctionFilter(config.Opt.Filter.Function)
+	}
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
+	control.Init(cancel)
+	if config.Opt.Filter.FunctionFile != "" {
+		go luaRuntime.WatchFile(ctx)
+		go reloadFunctionOnSignal(luaRuntime)
+	}
+
+	if v.IsSet("check") {
+		go waitShutdown()
+		mismatched := runCheck(ctx, v)
+		utils.ReleaseFileLock()
+		if mismatched != 0 {
+			os.Exit(1)
+		}
+		return
+	}
 
 	// create reader
 	var theReader reader.Reader
@@ -85,6 +129,12 @@ func main() {
 	default:
 		log.Panicf("no reader config entry found")
 	}
+	if config.Opt.Advanced.Bidirectional {
+		if !v.IsSet("sync_reader") {
+			log.Panicf("bidirectional sync only supports sync_reader")
+		}
+		log.Infof("bidirectional sync is enabled. bidirectional_marker=[%s]", config.Opt.Advanced.BidirectionalMarker)
+	}
 	// create writer
 	var theWriter writer.Writer
 	switch {
@@ -130,7 +180,7 @@ func main() {
 
 	log.Infof("start syncing...")
 
-	go waitShutdown(cancel)
+	go waitShutdown()
 
 	chrs := theReader.StartRead(ctx)
 
@@ -154,17 +204,25 @@ func main() {
 				// filter
 				if !filter.Filter(e) {
 					log.Debugf("skip command: %v", e)
+					if config.Opt.Advanced.StatusPort != 0 {
+						status.AddFilterDrop()
+					}
 					continue
 				}
 
-				// run lua function
-				log.Debugf("function before: %v", e)
-				entries := luaRuntime.RunFunction(e)
+				// transform
+				var entries []*entry.Entry
+				for _, theEntry := range transform.Transform(e) {
+					// run lua function
+					log.Debugf("function before: %v", theEntry)
+					entries = append(entries, luaRuntime.RunFunction(theEntry)...)
+				}
 				log.Debugf("function after: %v", entries)
 
 				// write
 				for _, theEntry := range entries {
 					theEntry.Parse()
+					control.Wait() // paused or rate limited by the control API
 					theWriter.Write(theEntry)
 
 					// update writer status
@@ -196,6 +254,8 @@ func main() {
 	ticker := time.NewTicker(1 * time.Second)
 	defer ticker.Stop()
 	readerCnt := len(chrs)
+	// detected here rather than in status, which runs only with status_port
+	lastConsistent, everConsistent := false, false
 Loop:
 	for {
 		select {
@@ -213,15 +273,58 @@ Loop:
 			pingEntry.Argv = []string{"PING"}
 			pingEntry.Group = "connection"
 			theWriter.Write(pingEntry)
+
+			if !everConsistent && hook.Enabled(hook.FirstConsistent) {
+				consistent := theReader.StatusConsistent() && theWriter.StatusConsistent()
+				if lastConsistent && consistent {
+					everConsistent = true
+					hook.Trigger(hook.FirstConsistent, "", "read_count=[%d], write_count=[%d]",
+						atomic.LoadUint64(&logEntryCount.ReadCount), atomic.LoadUint64(&logEntryCount.WriteCount))
+				}
+				lastConsistent = consistent
+			}
 		}
 	}
 
-	theWriter.Close()       // Wait for all writing operations to complete
+	theWriter.Close() // Wait for all writing operations to complete
+	filter.CloseDeadLetterFile()
+	writeCheckpoint(theReader, theWriter)
 	utils.ReleaseFileLock() // Release file lock
 	log.Infof("all done")
 }
 
-func waitShutdown(cancel context.CancelFunc) {
+// reloadFunctionOnSignal reloads the function file on SIGHUP.
+func reloadFunctionOnSignal(luaRuntime *filter.Runtime) {
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	for range hupCh {
+		log.Infof("Got signal: SIGHUP to reload the function file.")
+		luaRuntime.Reload()
+	}
+}
+
+// writeCheckpoint saves the final status of the reader and the writer. As all
+// the entries read are acknowledged by then, it records the offsets reached,
+// e.g. aof_sent_offset of each sync_reader shard.
+func writeCheckpoint(theReader reader.Reader, theWriter writer.Writer) {
+	checkpoint := struct {
+		Time   string      `json:"time"`
+		Reader interface{} `json:"reader"`
+		Writer interface{} `json:"writer"`
+	}{time.Now().Format("2006-01-02 15:04:05"), theReader.Status(), theWriter.Status()}
+	bytes, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		log.Warnf("marshal checkpoint failed. error=[%v]", err)
+		return
+	}
+	if err := os.WriteFile("checkpoint.json", bytes, 0644); err != nil {
+		log.Warnf("write checkpoint failed. error=[%v]", err)
+		return
+	}
+	log.Infof("checkpoint saved to %s", utils.GetAbsPath("checkpoint.json"))
+}
+
+func waitShutdown() {
 	quitCh := make(chan os.Signal, 1)
 	signal.Notify(quitCh, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	sigTimes := 0
@@ -235,7 +338,7 @@ func waitShutdown(cancel context.CancelFunc) {
 			if sigTimes >= 2 {
 				os.Exit(0)
 			}
-			cancel()
+			control.Stop()
 		}
 
 	}
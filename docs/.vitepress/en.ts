@@ -51,6 +51,7 @@ function sidebar(): DefaultTheme.SidebarItem[] {
             text: 'Filter and Processing',
             items: [
                 { text: 'Built-in Filter Rules', link: '/en/filter/filter' },
+                { text: 'Built-in Transform Rules', link: '/en/filter/transform' },
                 { text: 'What is function', link: '/en/filter/function' },
             ]
         },
@@ -60,6 +61,9 @@ function sidebar(): DefaultTheme.SidebarItem[] {
                 { text: 'Redis Modules', link: '/en/others/modules' },
                 { text: 'How to Verify Data Consistency', link: '/en/others/consistent' },
                 { text: 'Cross-version Migration', link: '/en/others/version' },
+                { text: 'Bidirectional Sync', link: '/en/others/bidirectional' },
+                { text: 'Monitoring', link: '/en/others/monitoring' },
+                { text: 'Lifecycle Hooks', link: '/en/others/hooks' },
             ]
         },
     ]
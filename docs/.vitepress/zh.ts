@@ -49,6 +49,7 @@ function sidebar(): DefaultTheme.SidebarItem[] {
             text: '过滤与加工',
             items: [
                 { text: '内置过滤规则', link: '/zh/filter/filter' },
+                { text: '内置转换规则', link: '/zh/filter/transform' },
                 { text: '什么是 function', link: '/zh/filter/function' },
             ]
         },
@@ -58,6 +59,9 @@ function sidebar(): DefaultTheme.SidebarItem[] {
                 { text: 'Redis Modules', link: '/zh/others/modules' },
                 { text: '如何判断数据一致', link: '/zh/others/consistent' },
                 { text: '跨版本迁移', link: '/zh/others/version' },
+                { text: '双向同步', link: '/zh/others/bidirectional' },
+                { text: '监控', link: '/zh/others/monitoring' },
+                { text: '生命周期钩子', link: '/zh/others/hooks' },
             ]
         },
     ]
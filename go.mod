@@ -3,6 +3,7 @@ module RedisShake
 go 1.21
 
 require (
+	github.com/a8m/envsubst v1.4.2
 	github.com/dustin/go-humanize v1.0.1
 	github.com/go-stack/stack v1.8.1
 	github.com/gofrs/flock v0.8.1
@@ -13,7 +14,6 @@ require (
 )
 
 require (
-	github.com/a8m/envsubst v1.4.2 // indirect
 	github.com/fsnotify/fsnotify v1.7.0 // indirect
 	github.com/hashicorp/hcl v1.0.0 // indirect
 	github.com/magiconair/properties v1.8.7 // indirect
@@ -151,6 +151,7 @@ func (ld *Loader) LoadSingleAppendOnlyFile(ctx context.Context, timestamp int64)
 				argv = append(argv, string(argString))
 			}
 			e.Argv = append(e.Argv, argv...)
+			e.Phase = entry.PhaseAOF
 			ld.ch <- e
 		}
 	}
@@ -0,0 +1,338 @@
+package checker
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"RedisShake/internal/config"
+	"RedisShake/internal/log"
+	"RedisShake/internal/utils"
+
+	"github.com/mcuadros/go-defaults"
+)
+
+type dbKey struct {
+	db  int
+	key string
+}
+
+// Checker compares the keys of the source and the target. The first round
+// scans both sides, the source for the keys missing or different in the
+// target, and the target for the keys missing in the source. The following
+// rounds check the mismatched keys again, so that the keys changed by the
+// writes in flight during a round are not reported once the sync catches up.
+type Checker struct {
+	ctx            context.Context
+	src            *EndpointOptions
+	dst            *EndpointOptions
+	opts           *config.CheckOptions
+	ttlToleranceMs int64
+
+	mux        sync.Mutex
+	mismatches map[dbKey]*Mismatch
+	round      int64
+	checked    int64
+}
+
+func NewChecker(ctx context.Context, src *EndpointOptions, dst *EndpointOptions) *Checker {
+	opts := &config.Opt.Check
+	if opts.Mode != "digest" && opts.Mode != "full" {
+		log.Panicf("invalid check mode. mode=[%s], should be digest or full", opts.Mode)
+	}
+	if opts.Rounds < 1 || opts.Count < 1 || opts.Interval < 0 || opts.TTLTolerance < 0 {
+		log.Panicf("invalid check options. rounds=[%d], count=[%d], interval=[%d], ttl_tolerance=[%d]",
+			opts.Rounds, opts.Count, opts.Interval, opts.TTLTolerance)
+	}
+	if options := transformingOptions(); len(options) > 0 {
+		log.Panicf("check mode compares the same keys on both sides, and does not support the options changing keys or values. options=%v", options)
+	}
+	return &Checker{
+		ctx:            ctx,
+		src:            src,
+		dst:            dst,
+		opts:           opts,
+		ttlToleranceMs: int64(opts.TTLTolerance) * 1000,
+		mismatches:     make(map[dbKey]*Mismatch),
+	}
+}
+
+// Run checks the source against the target and writes the report. It returns
+// the number of keys still mismatched after the last round.
+func (c *Checker) Run() int {
+	log.Infof("[check] start checking. source=[%s], target=[%s], mode=[%s], rounds=[%d]", c.src.Address, c.dst.Address, c.opts.Mode, c.opts.Rounds)
+	go c.logProgress()
+
+	for round := 1; round <= c.opts.Rounds; round++ {
+		atomic.StoreInt64(&c.round, int64(round))
+		atomic.StoreInt64(&c.checked, 0)
+		start := time.Now()
+		if round == 1 {
+			c.scanAll()
+		} else {
+			c.recheck()
+		}
+		if c.ctx.Err() != nil {
+			log.Warnf("[check] check stopped in round %d, the report is incomplete", round)
+			break
+		}
+		log.Infof("[check] round [%d/%d] finished. checked_keys=[%d], mismatched_keys=[%d], time_used=[%.2f]s",
+			round, c.opts.Rounds, atomic.LoadInt64(&c.checked), c.mismatchCount(), time.Since(start).Seconds())
+		if c.mismatchCount() == 0 || round == c.opts.Rounds {
+			break
+		}
+		select {
+		case <-c.ctx.Done():
+		case <-time.After(time.Duration(c.opts.Interval) * time.Second):
+		}
+	}
+	return c.writeReport()
+}
+
+// scanAll runs a worker for each node of the source and of the target.
+func (c *Checker) scanAll() {
+	var wg sync.WaitGroup
+	src := newEndpoint(c.ctx, c.src)
+	src.close()
+	for inx := range src.addresses {
+		wg.Add(1)
+		go func(inx int) {
+			defer wg.Done()
+			c.scanSource(inx)
+		}(inx)
+	}
+	dst := newEndpoint(c.ctx, c.dst)
+	dst.close()
+	for inx := range dst.addresses {
+		wg.Add(1)
+		go func(inx int) {
+			defer wg.Done()
+			c.scanTarget(inx)
+		}(inx)
+	}
+	wg.Wait()
+}
+
+// scanSource compares the keys of the node nodeInx of the source.
+func (c *Checker) scanSource(nodeInx int) {
+	src := newEndpoint(c.ctx, c.src)
+	defer src.close()
+	dst := newEndpoint(c.ctx, c.dst)
+	defer dst.close()
+	c.scan(src, nodeInx, func(db int, keys []string) {
+		dst.selectDb(db)
+		c.compare(src, dst, db, keys)
+	})
+}
+
+// scanTarget looks for the keys of the node nodeInx of the target that are
+// missing in the source, the other keys are compared by scanSource.
+func (c *Checker) scanTarget(nodeInx int) {
+	src := newEndpoint(c.ctx, c.src)
+	defer src.close()
+	dst := newEndpoint(c.ctx, c.dst)
+	defer dst.close()
+	c.scan(dst, nodeInx, func(db int, keys []string) {
+		src.selectDb(db)
+		replies := src.pipeline(keys, func(key string) []interface{} { return []interface{}{"exists", key} })
+		var extra []string
+		for inx, reply := range replies {
+			if reply == int64(0) {
+				extra = append(extra, keys[inx])
+			}
+		}
+		if len(extra) == 0 {
+			return
+		}
+		for inx, o := range dst.outlines(extra, false) {
+			if o.exists() {
+				c.record(db, extra[inx], "extra", nil, o)
+			}
+		}
+	})
+}
+
+func (c *Checker) scan(e *endpoint, nodeInx int, process func(db int, keys []string)) {
+	node := e.clients[nodeInx]
+	for _, db := range e.dbs() {
+		e.selectDb(db)
+		var cursor uint64
+		for {
+			if c.ctx.Err() != nil {
+				return
+			}
+			var keys []string
+			cursor, keys = node.Scan(cursor, c.opts.Count)
+			if len(keys) > 0 {
+				process(db, keys)
+			}
+			if cursor == 0 {
+				break
+			}
+		}
+	}
+}
+
+// recheck compares the mismatched keys again.
+func (c *Checker) recheck() {
+	c.mux.Lock()
+	keys := make(map[int][]string)
+	for k := range c.mismatches {
+		keys[k.db] = append(keys[k.db], k.key)
+	}
+	c.mux.Unlock()
+	src := newEndpoint(c.ctx, c.src)
+	defer src.close()
+	dst := newEndpoint(c.ctx, c.dst)
+	defer dst.close()
+	for db, dbKeys := range keys {
+		src.selectDb(db)
+		dst.selectDb(db)
+		for start := 0; start < len(dbKeys); start += c.opts.Count {
+			if c.ctx.Err() != nil {
+				return
+			}
+			c.compare(src, dst, db, dbKeys[start:min(start+c.opts.Count, len(dbKeys))])
+		}
+	}
+}
+
+func (c *Checker) compare(src *endpoint, dst *endpoint, db int, keys []string) {
+	digest := c.opts.Mode == "digest"
+	srcOutlines := src.outlines(keys, digest)
+	dstOutlines := dst.outlines(keys, digest)
+	for inx, key := range keys {
+		s, d := srcOutlines[inx], dstOutlines[inx]
+		reason := compareOutlines(s, d, c.ttlToleranceMs)
+		// the digests also differ when the servers encode the same value
+		// differently, so the values are compared to confirm
+		if reason == "" && s.exists() && (!digest || s.digest != d.digest) {
+			if !slices.Equal(src.value(key, s.Type), dst.value(key, d.Type)) {
+				reason = "value"
+			}
+		}
+		c.record(db, key, reason, s, d)
+	}
+	atomic.AddInt64(&c.checked, int64(len(keys)))
+}
+
+func (c *Checker) record(db int, key string, reason string, src *Outline, dst *Outline) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	k := dbKey{db, key}
+	if reason == "" {
+		delete(c.mismatches, k)
+		return
+	}
+	if !src.exists() {
+		src = nil
+	}
+	if !dst.exists() {
+		dst = nil
+	}
+	c.mismatches[k] = &Mismatch{Db: db, Key: key, Reason: reason, Source: src, Target: dst}
+}
+
+func (c *Checker) mismatchCount() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return len(c.mismatches)
+}
+
+func (c *Checker) logProgress() {
+	if config.Opt.Advanced.LogInterval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(time.Duration(config.Opt.Advanced.LogInterval) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-ticker.C:
+			log.Infof("[check] round=[%d/%d], checked_keys=[%d], mismatched_keys=[%d]",
+				atomic.LoadInt64(&c.round), c.opts.Rounds, atomic.LoadInt64(&c.checked), c.mismatchCount())
+		}
+	}
+}
+
+// writeReport writes the mismatched keys as JSON lines sorted by db and key.
+func (c *Checker) writeReport() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	mismatches := make([]*Mismatch, 0, len(c.mismatches))
+	reasons := make(map[string]int)
+	for _, m := range c.mismatches {
+		mismatches = append(mismatches, m)
+		reasons[m.Reason]++
+	}
+	sort.Slice(mismatches, func(i, j int) bool {
+		if mismatches[i].Db != mismatches[j].Db {
+			return mismatches[i].Db < mismatches[j].Db
+		}
+		return mismatches[i].Key < mismatches[j].Key
+	})
+	file, err := os.Create(c.opts.ReportFile)
+	if err != nil {
+		log.Panicf("create check report failed. file=[%s], error=[%v]", c.opts.ReportFile, err)
+	}
+	encoder := json.NewEncoder(file)
+	for _, m := range mismatches {
+		if err := encoder.Encode(m); err != nil {
+			log.Panicf("write check report failed. file=[%s], error=[%v]", c.opts.ReportFile, err)
+		}
+	}
+	if err := file.Close(); err != nil {
+		log.Panicf("close check report failed. file=[%s], error=[%v]", c.opts.ReportFile, err)
+	}
+	if len(mismatches) == 0 {
+		log.Infof("[check] the source and the target are consistent. report=[%s]", utils.GetAbsPath(c.opts.ReportFile))
+	} else {
+		log.Warnf("[check] found mismatched keys. count=[%d], reasons=%v, report=[%s]", len(mismatches), reasons, utils.GetAbsPath(c.opts.ReportFile))
+	}
+	return len(mismatches)
+}
+
+// transformingOptions returns the names of the options of [filter] and
+// [transform] that are set and make the target differ from the source.
+func transformingOptions() []string {
+	// the options without effect on their own
+	ignored := map[string]bool{
+		"mixed_keys_behavior":       true,
+		"function_error_behavior":   true,
+		"function_dead_letter_file": true,
+		"merge_db_prefix":           true,
+	}
+	var options []string
+	collect := func(section string, opts interface{}, defaultOpts interface{}) {
+		defaults.SetDefaults(defaultOpts)
+		v, d := reflect.ValueOf(opts).Elem(), reflect.ValueOf(defaultOpts).Elem()
+		for inx := 0; inx < v.NumField(); inx++ {
+			name := v.Type().Field(inx).Tag.Get("mapstructure")
+			field, defaultField := v.Field(inx), d.Field(inx)
+			if ignored[name] {
+				continue
+			}
+			switch field.Kind() {
+			case reflect.Slice, reflect.Map:
+				if field.Len() == 0 {
+					continue
+				}
+			default:
+				if field.Interface() == defaultField.Interface() {
+					continue
+				}
+			}
+			options = append(options, section+"."+name)
+		}
+	}
+	collect("filter", &config.Opt.Filter, &config.FilterOptions{})
+	collect("transform", &config.Opt.Transform, &config.TransformOptions{})
+	return options
+}
@@ -0,0 +1,30 @@
+package checker
+
+import (
+	"slices"
+	"testing"
+
+	"RedisShake/internal/config"
+
+	"github.com/mcuadros/go-defaults"
+)
+
+func TestTransformingOptions(t *testing.T) {
+	config.Opt = config.ShakeOptions{}
+	defaults.SetDefaults(&config.Opt)
+	config.Opt.Filter.AllowKeyPrefix = []string{} // as loaded from shake.toml
+	config.Opt.Filter.MixedKeysBehavior = "allow" // ignored, as it only applies to other filters
+	if options := transformingOptions(); len(options) != 0 {
+		t.Errorf("options of the default config = %v", options)
+	}
+
+	config.Opt.Filter.AllowKeyPrefix = []string{"user:"}
+	config.Opt.Filter.Function = "shake.call(DB, ARGV)"
+	config.Opt.Transform.MergeDb = true
+	config.Opt.Transform.TTLMultiply = 0.5
+	config.Opt.Transform.Masks = []config.MaskRule{{Method: "redact"}}
+	want := []string{"filter.allow_key_prefix", "filter.function", "transform.merge_db", "transform.ttl_multiply", "transform.mask"}
+	if options := transformingOptions(); !slices.Equal(options, want) {
+		t.Errorf("options = %v, want %v", options, want)
+	}
+}
@@ -0,0 +1,160 @@
+package checker
+
+import (
+	"fmt"
+	"sort"
+
+	"RedisShake/internal/log"
+)
+
+// outlineScript returns the type, the TTL in milliseconds and the length of
+// KEYS[1]. With ARGV[1] == "1", it also returns the SHA1 of the DUMP payload
+// without the RDB version and the checksum, so that values are compared without
+// transferring them.
+const outlineScript = `
+local t = redis.call('TYPE', KEYS[1])['ok']
+if t == 'none' then
+	return {t, -2, 0, ''}
+end
+local len = 0
+if t == 'string' then
+	len = redis.call('STRLEN', KEYS[1])
+elseif t == 'list' then
+	len = redis.call('LLEN', KEYS[1])
+elseif t == 'set' then
+	len = redis.call('SCARD', KEYS[1])
+elseif t == 'zset' then
+	len = redis.call('ZCARD', KEYS[1])
+elseif t == 'hash' then
+	len = redis.call('HLEN', KEYS[1])
+elseif t == 'stream' then
+	len = redis.call('XLEN', KEYS[1])
+end
+local digest = ''
+if ARGV[1] == '1' then
+	digest = redis.sha1hex(string.sub(redis.call('DUMP', KEYS[1]), 1, -11))
+end
+return {t, redis.call('PTTL', KEYS[1]), len, digest}
+`
+
+type Outline struct {
+	Type   string `json:"type"`
+	TTLMs  int64  `json:"ttl_ms"` // -1 means no TTL
+	Length int64  `json:"length"`
+	digest string
+}
+
+func (o *Outline) exists() bool {
+	return o != nil && o.Type != "none"
+}
+
+// Mismatch is a line of the report.
+type Mismatch struct {
+	Db     int      `json:"db"`
+	Key    string   `json:"key"`
+	Reason string   `json:"reason"` // missing, extra, type, length, ttl or value
+	Source *Outline `json:"source,omitempty"`
+	Target *Outline `json:"target,omitempty"`
+}
+
+func (e *endpoint) outlines(keys []string, digest bool) []*Outline {
+	withDigest := "0"
+	if digest {
+		withDigest = "1"
+	}
+	replies := e.pipeline(keys, func(key string) []interface{} {
+		return []interface{}{"evalsha", e.scriptSha, "1", key, withDigest}
+	})
+	outlines := make([]*Outline, len(keys))
+	for inx, reply := range replies {
+		items, ok := reply.([]interface{})
+		if !ok || len(items) != 4 {
+			log.Panicf("[%s] invalid reply of the outline script. key=[%s], reply=[%v]", e.opts.Address, keys[inx], reply)
+		}
+		o := &Outline{}
+		o.Type, _ = items[0].(string)
+		o.TTLMs, _ = items[1].(int64)
+		o.Length, _ = items[2].(int64)
+		o.digest, _ = items[3].(string)
+		outlines[inx] = o
+	}
+	return outlines
+}
+
+// compareOutlines returns the reason the outlines mismatch, or "" if they
+// match. The TTLs match when they differ by at most ttlToleranceMs, as they are
+// read at different times.
+func compareOutlines(src *Outline, dst *Outline, ttlToleranceMs int64) string {
+	switch {
+	case !src.exists() && !dst.exists():
+		return ""
+	case !dst.exists():
+		return "missing"
+	case !src.exists():
+		return "extra"
+	case src.Type != dst.Type:
+		return "type"
+	case src.Length != dst.Length:
+		return "length"
+	case (src.TTLMs == -1) != (dst.TTLMs == -1):
+		return "ttl"
+	case src.TTLMs-dst.TTLMs > ttlToleranceMs || dst.TTLMs-src.TTLMs > ttlToleranceMs:
+		return "ttl"
+	}
+	return ""
+}
+
+// value returns the value of key in a form comparable between servers, the
+// members of sets and the fields of hashes are sorted.
+func (e *endpoint) value(key string, typ string) []string {
+	var argv []interface{}
+	switch typ {
+	case "string":
+		argv = []interface{}{"get", key}
+	case "list":
+		argv = []interface{}{"lrange", key, "0", "-1"}
+	case "set":
+		argv = []interface{}{"smembers", key}
+	case "zset":
+		argv = []interface{}{"zrange", key, "0", "-1", "withscores"}
+	case "hash":
+		argv = []interface{}{"hgetall", key}
+	case "stream":
+		argv = []interface{}{"xrange", key, "-", "+"}
+	default: // module types, the payload of DUMP depends on the module only
+		argv = []interface{}{"dump", key}
+	}
+	reply := e.pipeline([]string{key}, func(string) []interface{} { return argv })[0]
+	return normalizeValue(typ, reply)
+}
+
+func normalizeValue(typ string, reply interface{}) []string {
+	switch reply := reply.(type) {
+	case nil:
+		return nil
+	case string:
+		if typ != "string" && len(reply) >= 10 { // DUMP, without the RDB version and the checksum
+			reply = reply[:len(reply)-10]
+		}
+		return []string{reply}
+	case []interface{}:
+		items := make([]string, len(reply))
+		for inx, item := range reply {
+			items[inx] = fmt.Sprint(item)
+		}
+		switch typ {
+		case "set":
+			sort.Strings(items)
+		case "hash":
+			pairs := make([]string, 0, len(items)/2)
+			for inx := 0; inx+1 < len(items); inx += 2 {
+				pairs = append(pairs, items[inx]+"\x00"+items[inx+1])
+			}
+			sort.Strings(pairs)
+			items = pairs
+		}
+		return items
+	default:
+		return []string{fmt.Sprint(reply)}
+	}
+}
@@ -0,0 +1,54 @@
+package checker
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestCompareOutlines(t *testing.T) {
+	none := &Outline{Type: "none", TTLMs: -2}
+	str := &Outline{Type: "string", TTLMs: -1, Length: 5}
+	tests := []struct {
+		src, dst *Outline
+		want     string
+	}{
+		{none, none, ""},
+		{str, none, "missing"},
+		{none, str, "extra"},
+		{str, &Outline{Type: "list", TTLMs: -1, Length: 5}, "type"},
+		{str, &Outline{Type: "string", TTLMs: -1, Length: 6}, "length"},
+		{str, &Outline{Type: "string", TTLMs: 10000, Length: 5}, "ttl"},
+		{&Outline{Type: "string", TTLMs: 10000, Length: 5}, &Outline{Type: "string", TTLMs: 6000, Length: 5}, "ttl"},
+		{&Outline{Type: "string", TTLMs: 10000, Length: 5}, &Outline{Type: "string", TTLMs: 7000, Length: 5}, ""},
+	}
+	for _, tt := range tests {
+		if got := compareOutlines(tt.src, tt.dst, 3000); got != tt.want {
+			t.Errorf("compareOutlines(%+v, %+v) = %q, want %q", tt.src, tt.dst, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeValue(t *testing.T) {
+	set1 := normalizeValue("set", []interface{}{"b", "a", "c"})
+	set2 := normalizeValue("set", []interface{}{"c", "b", "a"})
+	if !slices.Equal(set1, set2) {
+		t.Errorf("sets differ: %q, %q", set1, set2)
+	}
+	hash1 := normalizeValue("hash", []interface{}{"f1", "v1", "f2", "v2"})
+	hash2 := normalizeValue("hash", []interface{}{"f2", "v2", "f1", "v1"})
+	if !slices.Equal(hash1, hash2) {
+		t.Errorf("hashes differ: %q, %q", hash1, hash2)
+	}
+	if hash3 := normalizeValue("hash", []interface{}{"f1", "v2", "f2", "v1"}); slices.Equal(hash1, hash3) {
+		t.Errorf("hashes with swapped values are equal: %q", hash3)
+	}
+	list1 := normalizeValue("list", []interface{}{"a", "b"})
+	list2 := normalizeValue("list", []interface{}{"b", "a"})
+	if slices.Equal(list1, list2) {
+		t.Errorf("lists in different orders are equal: %q", list1)
+	}
+	dump := normalizeValue("MBbloom--", "payload"+"\x0b\x00"+"checksum")
+	if !slices.Equal(dump, []string{"payload"}) {
+		t.Errorf("dump = %q, want the payload without the trailer", dump)
+	}
+}
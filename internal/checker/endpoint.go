@@ -0,0 +1,121 @@
+package checker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"RedisShake/internal/client"
+	"RedisShake/internal/client/proto"
+	"RedisShake/internal/commands"
+	"RedisShake/internal/log"
+	"RedisShake/internal/utils"
+)
+
+type EndpointOptions struct {
+	Cluster       bool
+	Address       string
+	Username      string
+	Password      string
+	Tls           bool
+	PreferReplica bool
+	DBS           []int // dbs to check, empty means the dbs having keys
+}
+
+const keySlots = 16384
+
+// endpoint is the source or the target. It holds one connection to each node,
+// which is not safe for concurrent use, so each worker opens its own endpoint.
+type endpoint struct {
+	opts      *EndpointOptions
+	addresses []string
+	clients   []*client.Redis
+	router    [keySlots]*client.Redis // clusters only
+	db        int
+	scriptSha string
+}
+
+func newEndpoint(ctx context.Context, opts *EndpointOptions) *endpoint {
+	e := &endpoint{opts: opts}
+	if !opts.Cluster {
+		e.addresses = []string{opts.Address}
+		e.clients = []*client.Redis{client.NewRedisClient(ctx, opts.Address, opts.Username, opts.Password, opts.Tls, opts.PreferReplica)}
+	} else {
+		addresses, slots := utils.GetRedisClusterNodes(ctx, opts.Address, opts.Username, opts.Password, opts.Tls, opts.PreferReplica)
+		for inx, address := range addresses {
+			c := client.NewRedisClient(ctx, address, opts.Username, opts.Password, opts.Tls, false)
+			if opts.PreferReplica {
+				c.Do("READONLY")
+			}
+			for _, slot := range slots[inx] {
+				e.router[slot] = c
+			}
+			e.addresses = append(e.addresses, address)
+			e.clients = append(e.clients, c)
+		}
+		for slot := 0; slot < keySlots; slot++ {
+			if e.router[slot] == nil {
+				log.Panicf("slot %d is not served by any node. address=[%s]", slot, opts.Address)
+			}
+		}
+	}
+	for _, c := range e.clients {
+		e.scriptSha = c.DoWithStringReply("SCRIPT", "LOAD", outlineScript)
+	}
+	return e
+}
+
+func (e *endpoint) close() {
+	for _, c := range e.clients {
+		c.Close()
+	}
+}
+
+// dbs returns the dbs to check, a cluster has db 0 only.
+func (e *endpoint) dbs() []int {
+	if e.opts.Cluster {
+		return []int{0}
+	}
+	if len(e.opts.DBS) != 0 {
+		return e.opts.DBS
+	}
+	return utils.ParseDBs(e.clients[0].DoWithStringReply("INFO", "keyspace"))
+}
+
+func (e *endpoint) selectDb(db int) {
+	if e.opts.Cluster || e.db == db {
+		return
+	}
+	if reply := e.clients[0].DoWithStringReply("SELECT", strconv.Itoa(db)); reply != "OK" {
+		log.Panicf("select db failed. address=[%s], db=[%d], reply=[%s]", e.opts.Address, db, reply)
+	}
+	e.db = db
+}
+
+func (e *endpoint) clientOf(key string) *client.Redis {
+	if !e.opts.Cluster {
+		return e.clients[0]
+	}
+	return e.router[commands.CalcSlots([]string{key})[0]]
+}
+
+// pipeline sends the command returned by argv for each key to the node of the
+// key, then receives the replies in the order of keys.
+func (e *endpoint) pipeline(keys []string, argv func(key string) []interface{}) []interface{} {
+	for _, key := range keys {
+		e.clientOf(key).Send(argv(key)...)
+	}
+	replies := make([]interface{}, len(keys))
+	for inx, key := range keys {
+		reply, err := e.clientOf(key).Receive()
+		if errors.Is(err, proto.Nil) {
+			continue
+		}
+		if err != nil {
+			log.Panicf("[%s] %s failed. key=[%s], error=[%v]", e.opts.Address, strings.ToUpper(argv(key)[0].(string)), key, err)
+		}
+		replies[inx] = reply
+	}
+	return replies
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"bytes"
+	"strconv"
 	"strings"
 
 	"RedisShake/internal/client/proto"
@@ -26,3 +27,68 @@ func (r *Redis) IsCluster() bool {
 	reply := r.DoWithStringReply("INFO", "Cluster")
 	return strings.Contains(reply, "cluster_enabled:1")
 }
+
+// RedisVersion returns the redis_version reported by INFO server, encoded as
+// major*10000 + minor*100 + patch (v7.0.11 <=> 70011). It returns 0 if the
+// server does not report a parsable version, e.g. a proxy that disables INFO.
+func (r *Redis) RedisVersion() int {
+	r.Send("INFO", "Server")
+	reply, err := r.Receive()
+	if err != nil {
+		log.Warnf("INFO server failed, the redis version is unknown. error=[%v]", err)
+		return 0
+	}
+	info, _ := reply.(string)
+	for _, line := range strings.Split(info, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "redis_version:") {
+			return ParseRedisVersion(strings.TrimPrefix(line, "redis_version:"))
+		}
+	}
+	return 0
+}
+
+// ParseRedisVersion converts a version string such as "6.2.14" to 60214.
+func ParseRedisVersion(version string) int {
+	items := strings.Split(version, ".")
+	if len(items) == 0 || len(items) > 3 {
+		return 0
+	}
+	ret := 0
+	for i := 0; i < 3; i++ {
+		ret *= 100
+		if i < len(items) {
+			n, err := strconv.Atoi(items[i])
+			if err != nil {
+				return 0
+			}
+			ret += n
+		}
+	}
+	return ret
+}
+
+// OwnedSlot returns the first slot served by the server. It returns 0 if the
+// server is not in cluster mode or serves no slot.
+func (r *Redis) OwnedSlot() int {
+	if !r.IsCluster() {
+		return 0
+	}
+	reply := r.DoWithStringReply("CLUSTER", "NODES")
+	for _, line := range strings.Split(reply, "\n") {
+		words := strings.Fields(line)
+		if len(words) < 9 || !strings.Contains(words[2], "myself") {
+			continue
+		}
+		for _, word := range words[8:] {
+			if strings.HasPrefix(word, "[") { // migrating or importing slot
+				continue
+			}
+			slot, err := strconv.Atoi(strings.Split(word, "-")[0])
+			if err == nil {
+				return slot
+			}
+		}
+	}
+	return 0
+}
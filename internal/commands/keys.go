@@ -37,18 +37,18 @@ func CalcKeys(argv []string) (cmaName string, group string, keys []string, keysI
 				inx = spec.beginSearchStartFrom
 				step = 1
 			} else {
-				inx = -spec.beginSearchStartFrom
+				inx = argc + spec.beginSearchStartFrom
 				step = -1
 			}
-			for ; ; inx += step {
-				if inx == argc {
-					log.Panicf("not found keyword. argv=%v", argv)
-				}
+			for ; inx > 0 && inx < argc; inx += step {
 				if strings.ToUpper(argv[inx]) == spec.beginSearchKeyword {
 					begin = inx + 1
 					break
 				}
 			}
+			if begin == 0 { // optional keyword such as STOREDIST of GEORADIUS
+				continue
+			}
 		default:
 			log.Panicf("wrong type: %s", spec.beginSearchType)
 		}
@@ -61,8 +61,8 @@ func CalcKeys(argv []string) (cmaName string, group string, keys []string, keysI
 				lastKeyInx = argc + spec.findKeysRangeLastKey
 			}
 			limitCount := math.MaxInt32
-			if spec.findKeysRangeLimit <= -2 {
-				limitCount = (argc - begin) / (-spec.findKeysRangeLimit)
+			if spec.findKeysRangeLimit >= 2 {
+				limitCount = (argc - begin) / spec.findKeysRangeLimit
 			}
 			keyStep := spec.findKeysRangeKeyStep
 			for inx := begin; inx <= lastKeyInx && limitCount > 0; inx += keyStep {
@@ -119,3 +119,18 @@ findHashTag:
 	}
 	return utils.Crc16(key) & 0x3FFF
 }
+
+// KeyStep returns the distance between two keys of a command whose only key
+// spec takes every key from a fixed index to the end of the arguments, such
+// as DEL (1) and MSET (2). It returns 0 for other commands.
+func KeyStep(cmdName string) int {
+	cmd, ok := redisCommands[cmdName]
+	if !ok || len(cmd.keySpec) != 1 {
+		return 0
+	}
+	spec := cmd.keySpec[0]
+	if spec.beginSearchType != "index" || spec.findKeysType != "range" || spec.findKeysRangeLastKey != -1 || spec.findKeysRangeLimit != 0 {
+		return 0
+	}
+	return spec.findKeysRangeKeyStep
+}
@@ -41,6 +41,18 @@ func TestCalcKeys(t *testing.T) {
 		t.Errorf("CalcKeys(ZUNIONSTORE key 2 key1 key2) failed. cmd=%s, group=%s, keys=%v", cmd, group, keys)
 	}
 
+	// GEORADIUS without the optional STOREDIST keyword
+	cmd, group, keys, _ = CalcKeys([]string{"GEORADIUS", "key", "0", "0", "1", "km", "STORE", "dst"})
+	if cmd != "GEORADIUS" || group != "GEO" || !testEq(keys, []string{"key", "dst"}) {
+		t.Errorf("CalcKeys(GEORADIUS key 0 0 1 km STORE dst) failed. cmd=%s, group=%s, keys=%v", cmd, group, keys)
+	}
+
+	// XREAD, half of the arguments after STREAMS are keys
+	cmd, group, keys, _ = CalcKeys([]string{"XREAD", "COUNT", "2", "STREAMS", "key1", "key2", "0", "0"})
+	if cmd != "XREAD" || group != "STREAM" || !testEq(keys, []string{"key1", "key2"}) {
+		t.Errorf("CalcKeys(XREAD COUNT 2 STREAMS key1 key2 0 0) failed. cmd=%s, group=%s, keys=%v", cmd, group, keys)
+	}
+
 	// COMMAND
 	cmd, group, keys, _ = CalcKeys([]string{"COMMAND"})
 	if cmd != "COMMAND" || group != "SERVER" || !testEq(keys, []string{}) {
@@ -0,0 +1,81 @@
+package commands
+
+import (
+	"slices"
+	"strings"
+)
+
+// optionSpec describes the options of a command. The key specs tell where the
+// keys are, but not which arguments are options, so only the commands listed in
+// commandOptions support removing options.
+type optionSpec struct {
+	start   int            // index in argv of the first option
+	leading bool           // the options precede the values, e.g. ZADD key [NX] score member
+	arity   map[string]int // number of arguments following each option, -1 means [=|~] threshold
+}
+
+var commandOptions = map[string]optionSpec{
+	"SET": {start: 3, arity: map[string]int{
+		"NX": 0, "XX": 0, "GET": 0, "KEEPTTL": 0, "EX": 1, "PX": 1, "EXAT": 1, "PXAT": 1}},
+	"GETEX": {start: 2, arity: map[string]int{
+		"PERSIST": 0, "EX": 1, "PX": 1, "EXAT": 1, "PXAT": 1}},
+	"EXPIRE":    {start: 3, arity: map[string]int{"NX": 0, "XX": 0, "GT": 0, "LT": 0}},
+	"PEXPIRE":   {start: 3, arity: map[string]int{"NX": 0, "XX": 0, "GT": 0, "LT": 0}},
+	"EXPIREAT":  {start: 3, arity: map[string]int{"NX": 0, "XX": 0, "GT": 0, "LT": 0}},
+	"PEXPIREAT": {start: 3, arity: map[string]int{"NX": 0, "XX": 0, "GT": 0, "LT": 0}},
+	"RESTORE": {start: 4, arity: map[string]int{
+		"REPLACE": 0, "ABSTTL": 0, "IDLETIME": 1, "FREQ": 1}},
+	"COPY":   {start: 3, arity: map[string]int{"REPLACE": 0, "DB": 1}},
+	"ZADD":   {start: 2, leading: true, arity: map[string]int{"NX": 0, "XX": 0, "GT": 0, "LT": 0, "CH": 0, "INCR": 0}},
+	"GEOADD": {start: 2, leading: true, arity: map[string]int{"NX": 0, "XX": 0, "CH": 0}},
+	"XADD": {start: 2, leading: true, arity: map[string]int{
+		"NOMKSTREAM": 0, "MAXLEN": -1, "MINID": -1, "LIMIT": 1}},
+}
+
+// HasOption returns whether option is an option of cmdName that RemoveOptions
+// can remove.
+func HasOption(cmdName string, option string) bool {
+	spec, ok := commandOptions[strings.ToUpper(cmdName)]
+	if !ok {
+		return false
+	}
+	_, ok = spec.arity[strings.ToUpper(option)]
+	return ok
+}
+
+// RemoveOptions returns argv without the options in options, ignoring case,
+// together with their arguments. Keys and values are never removed, and argv is
+// returned unchanged if the command is not in commandOptions.
+func RemoveOptions(argv []string, options []string) []string {
+	spec, ok := commandOptions[strings.ToUpper(argv[0])]
+	if !ok || len(argv) <= spec.start {
+		return argv
+	}
+	ret := slices.Clone(argv[:spec.start])
+	inx := spec.start
+	for inx < len(argv) {
+		option := strings.ToUpper(argv[inx])
+		arity, ok := spec.arity[option]
+		if !ok {
+			if spec.leading { // the values start here
+				break
+			}
+			ret = append(ret, argv[inx])
+			inx++
+			continue
+		}
+		end := inx + 1 + arity
+		if arity == -1 {
+			end = inx + 2
+			if end <= len(argv) && (argv[inx+1] == "=" || argv[inx+1] == "~") {
+				end++
+			}
+		}
+		end = min(end, len(argv))
+		if !slices.ContainsFunc(options, func(o string) bool { return strings.EqualFold(o, option) }) {
+			ret = append(ret, argv[inx:end]...)
+		}
+		inx = end
+	}
+	return append(ret, argv[inx:]...)
+}
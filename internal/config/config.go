@@ -19,6 +19,17 @@ type FilterOptions struct {
 	AllowKeySuffix    []string `mapstructure:"allow_key_suffix" default:"[]"`
 	BlockKeyPrefix    []string `mapstructure:"block_key_prefix" default:"[]"`
 	BlockKeySuffix    []string `mapstructure:"block_key_suffix" default:"[]"`
+	AllowKeyRegex     []string `mapstructure:"allow_key_regex" default:"[]"`
+	BlockKeyRegex     []string `mapstructure:"block_key_regex" default:"[]"`
+	AllowKeyGlob      []string `mapstructure:"allow_key_glob" default:"[]"`
+	BlockKeyGlob      []string `mapstructure:"block_key_glob" default:"[]"`
+	MixedKeysBehavior string   `mapstructure:"mixed_keys_behavior" default:"drop"`
+	AllowValueType    []string `mapstructure:"allow_value_type" default:"[]"`
+	BlockValueType    []string `mapstructure:"block_value_type" default:"[]"`
+	MaxValueSize      int64    `mapstructure:"max_value_size" default:"0"` // in bytes, 0 means no limit
+	MinTTL            int64    `mapstructure:"min_ttl" default:"0"`        // in seconds, 0 means no limit
+	SampleRatio       float64  `mapstructure:"sample_ratio" default:"1"`
+	SampleSeed        int64    `mapstructure:"sample_seed" default:"0"`
 	AllowDB           []int    `mapstructure:"allow_db" default:"[]"`
 	BlockDB           []int    `mapstructure:"block_db" default:"[]"`
 	AllowCommand      []string `mapstructure:"allow_command" default:"[]"`
@@ -26,6 +37,66 @@ type FilterOptions struct {
 	AllowCommandGroup []string `mapstructure:"allow_command_group" default:"[]"`
 	BlockCommandGroup []string `mapstructure:"block_command_group" default:"[]"`
 	Function          string   `mapstructure:"function" default:""`
+	FunctionFile      string   `mapstructure:"function_file" default:""`
+
+	// what to do with an entry when the function raises an error:
+	// panic, pass (write the original entry), drop, or dead_letter (write it
+	// to function_dead_letter_file and drop it)
+	FunctionErrorBehavior  string `mapstructure:"function_error_behavior" default:"panic"`
+	FunctionDeadLetterFile string `mapstructure:"function_dead_letter_file" default:"function_dead_letter.jsonl"`
+}
+
+type TransformOptions struct {
+	AddKeyPrefix   string             `mapstructure:"add_key_prefix" default:""`
+	StripKeyPrefix string             `mapstructure:"strip_key_prefix" default:""`
+	KeyPrefixMap   []KeyPrefixMapping `mapstructure:"key_prefix_map"`
+
+	DbMap         map[string]int `mapstructure:"db_map"`
+	MergeDb       bool           `mapstructure:"merge_db" default:"false"`
+	MergeDbPrefix string         `mapstructure:"merge_db_prefix" default:"db%d:"`
+
+	// TTL policy, durations in seconds
+	TTLStrip    bool    `mapstructure:"ttl_strip" default:"false"`
+	TTLMultiply float64 `mapstructure:"ttl_multiply" default:"1"`
+	TTLMin      int64   `mapstructure:"ttl_min" default:"0"`
+	TTLMax      int64   `mapstructure:"ttl_max" default:"0"`
+	TTLJitter   int64   `mapstructure:"ttl_jitter" default:"0"`
+
+	Rules []TransformRule `mapstructure:"rule"`
+	Masks []MaskRule      `mapstructure:"mask"`
+}
+
+// TransformRule is a [[transform.rule]] item. The actions apply to the
+// commands matching all the conditions, empty conditions match everything.
+type TransformRule struct {
+	Command  []string `mapstructure:"command"`
+	Group    []string `mapstructure:"group"`
+	KeyRegex string   `mapstructure:"key_regex"`
+	Db       []int    `mapstructure:"db"`
+
+	RenameCommand string   `mapstructure:"rename_command"`
+	RemoveArgs    []string `mapstructure:"remove_args"`
+	RenameKey     string   `mapstructure:"rename_key"`
+	SetTTL        int64    `mapstructure:"set_ttl"` // in seconds
+	MaxTTL        int64    `mapstructure:"max_ttl"` // in seconds
+	StripTTL      bool     `mapstructure:"strip_ttl"`
+	ToDb          *int     `mapstructure:"to_db"`
+	Drop          bool     `mapstructure:"drop"`
+}
+
+// MaskRule is a [[transform.mask]] item. It masks the string values, or the
+// values of the given hash fields, of the keys matching KeyRegex.
+type MaskRule struct {
+	KeyRegex   string   `mapstructure:"key_regex"`
+	Fields     []string `mapstructure:"fields"`
+	ValueRegex string   `mapstructure:"value_regex"`
+	Method     string   `mapstructure:"method"` // hash, redact or fake
+	Salt       string   `mapstructure:"salt"`
+}
+
+type KeyPrefixMapping struct {
+	From string `mapstructure:"from"`
+	To   string `mapstructure:"to"`
 }
 
 type AdvancedOptions struct {
@@ -36,10 +107,26 @@ type AdvancedOptions struct {
 	PprofPort  int `mapstructure:"pprof_port" default:"0"`
 	StatusPort int `mapstructure:"status_port" default:"0"`
 
+	RateLimit int64 `mapstructure:"rate_limit" default:"0"` // entries written per second, 0 means no limit
+
+	// probes on the status port: /healthz fails when a connection has received
+	// nothing for health_timeout seconds, /readyz fails until the replication
+	// lag is at most ready_max_lag seconds
+	HealthTimeout int `mapstructure:"health_timeout" default:"60"`
+	ReadyMaxLag   int `mapstructure:"ready_max_lag" default:"10"`
+
 	// log
-	LogFile     string `mapstructure:"log_file" default:"shake.log"`
-	LogLevel    string `mapstructure:"log_level" default:"info"`
-	LogInterval int    `mapstructure:"log_interval" default:"5"`
+	LogFile     string            `mapstructure:"log_file" default:"shake.log"`
+	LogLevel    string            `mapstructure:"log_level" default:"info"`
+	LogLevels   map[string]string `mapstructure:"log_levels"` // levels of the reader, writer and filter
+	LogFormat   string            `mapstructure:"log_format" default:"console"`
+	LogInterval int               `mapstructure:"log_interval" default:"5"`
+
+	// rotation of the log file, 0 means disabled
+	LogMaxSize        int `mapstructure:"log_max_size" default:"0"`        // megabytes
+	LogRotateInterval int `mapstructure:"log_rotate_interval" default:"0"` // hours
+	LogMaxBackups     int `mapstructure:"log_max_backups" default:"0"`
+	LogMaxAge         int `mapstructure:"log_max_age" default:"0"` // days
 
 	// redis-shake gets key and value from rdb file, and uses RESTORE command to
 	// create the key in target redis. Redis RESTORE will return a "Target key name
@@ -50,6 +137,13 @@ type AdvancedOptions struct {
 	// ignore:  redis-shake will skip restore the key when meet "Target key name is busy" error.
 	RDBRestoreCommandBehavior string `mapstructure:"rdb_restore_command_behavior" default:"panic"`
 
+	// redis-shake verifies the CRC64 at the end of the RDB file before parsing it.
+	// On a checksum mismatch or a truncated file:
+	// panic: redis-shake will stop without sending any key.
+	// warn:  redis-shake will log a warning and parse the file anyway.
+	// skip:  redis-shake will not verify the file.
+	RDBChecksumBehavior string `mapstructure:"rdb_checksum_behavior" default:"panic"`
+
 	PipelineCountLimit              uint64 `mapstructure:"pipeline_count_limit" default:"1024"`
 	TargetRedisClientMaxQuerybufLen int64  `mapstructure:"target_redis_client_max_querybuf_len" default:"1024000000"`
 	TargetRedisProtoMaxBulkLen      uint64 `mapstructure:"target_redis_proto_max_bulk_len" default:"512000000"`
@@ -57,6 +151,32 @@ type AdvancedOptions struct {
 	AwsPSync string `mapstructure:"aws_psync" default:""` // 10.0.0.1:6379@nmfu2sl5osync,10.0.0.1:6379@xhma21xfkssync
 
 	EmptyDBBeforeSync bool `mapstructure:"empty_db_before_sync" default:"false"`
+
+	// bidirectional sync: every command is written in a transaction together
+	// with a marker key, and transactions carrying a marker key are not synced
+	// back from the source.
+	Bidirectional       bool   `mapstructure:"bidirectional" default:"false"`
+	BidirectionalMarker string `mapstructure:"bidirectional_marker" default:"redis-shake:loop:"`
+}
+
+// HookOptions configures the command and the webhook run on lifecycle events.
+type HookOptions struct {
+	Command      string   `mapstructure:"command" default:""` // run by sh -c, the event is passed in SHAKE_* environment variables
+	Webhook      string   `mapstructure:"webhook" default:""` // the event is POSTed as JSON
+	Events       []string `mapstructure:"events" default:"[]"`
+	LagThreshold int      `mapstructure:"lag_threshold" default:"60"` // in seconds, 0 means no lag_above_threshold event
+	Timeout      int      `mapstructure:"timeout" default:"10"`       // in seconds
+}
+
+// CheckOptions configures the check mode, which compares the source and the
+// target instead of syncing them.
+type CheckOptions struct {
+	Mode         string `mapstructure:"mode" default:"digest"` // digest or full
+	Rounds       int    `mapstructure:"rounds" default:"3"`
+	Interval     int    `mapstructure:"interval" default:"5"`      // in seconds, between rounds
+	TTLTolerance int    `mapstructure:"ttl_tolerance" default:"5"` // in seconds
+	Count        int    `mapstructure:"count" default:"100"`       // keys per SCAN and per batch of comparisons
+	ReportFile   string `mapstructure:"report_file" default:"check_report.jsonl"`
 }
 
 type ModuleOptions struct {
@@ -75,9 +195,12 @@ func (opt *AdvancedOptions) GetPSyncCommand(address string) string {
 }
 
 type ShakeOptions struct {
-	Filter   FilterOptions
-	Advanced AdvancedOptions
-	Module   ModuleOptions
+	Filter    FilterOptions
+	Transform TransformOptions
+	Advanced  AdvancedOptions
+	Hook      HookOptions
+	Check     CheckOptions
+	Module    ModuleOptions
 }
 
 var Opt ShakeOptions
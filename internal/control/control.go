@@ -0,0 +1,184 @@
+package control
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"RedisShake/internal/config"
+	"RedisShake/internal/log"
+)
+
+// The writer side of the pipeline is gated by Wait, which blocks while paused
+// and paces the entries to the rate limit. The readers keep receiving, the
+// sync reader buffers the replication stream on disk while paused.
+var (
+	mux      sync.Mutex
+	paused   bool
+	resumed  chan struct{} // closed on resume
+	stopping bool
+	stop     context.CancelFunc
+
+	limit int64     // entries per second, 0 means no limit
+	next  time.Time // the time the next entry is allowed
+
+	// gated is set while paused or rate limited, so that Wait does not take
+	// the lock for every entry otherwise
+	gated atomic.Bool
+)
+
+func updateGatedLocked() {
+	gated.Store(paused || limit > 0)
+}
+
+// Init sets the rate_limit option and the function stopping the readers.
+func Init(cancel context.CancelFunc) {
+	mux.Lock()
+	defer mux.Unlock()
+	stop = cancel
+	limit = config.Opt.Advanced.RateLimit
+	if limit < 0 {
+		log.Panicf("rate_limit can not be negative. rate_limit=[%d]", limit)
+	}
+	if limit != 0 {
+		log.Infof("rate limit. entries_per_second=[%d]", limit)
+	}
+	updateGatedLocked()
+}
+
+func Pause() {
+	mux.Lock()
+	defer mux.Unlock()
+	if paused || stopping {
+		return
+	}
+	paused = true
+	resumed = make(chan struct{})
+	updateGatedLocked()
+	log.Infof("pause writing")
+}
+
+func Resume() {
+	mux.Lock()
+	defer mux.Unlock()
+	resumeLocked()
+}
+
+func resumeLocked() {
+	if !paused {
+		return
+	}
+	paused = false
+	close(resumed)
+	updateGatedLocked()
+	log.Infof("resume writing")
+}
+
+// SetRateLimit changes the rate limit in entries per second, 0 removes it.
+func SetRateLimit(entriesPerSecond int64) {
+	mux.Lock()
+	defer mux.Unlock()
+	limit = entriesPerSecond
+	next = time.Time{}
+	updateGatedLocked()
+	log.Infof("set rate limit. entries_per_second=[%d]", limit)
+}
+
+// Stop stops the readers and resumes writing, so that the entries already
+// read are written and acknowledged before redis-shake exits.
+func Stop() {
+	mux.Lock()
+	defer mux.Unlock()
+	if stopping {
+		return
+	}
+	stopping = true
+	resumeLocked()
+	log.Infof("stop reading, wait for the entries already read to be written")
+	if stop != nil {
+		stop()
+	}
+}
+
+// Wait blocks while writing is paused, then until the rate limit allows one
+// more entry.
+func Wait() {
+	if !gated.Load() {
+		return
+	}
+	mux.Lock()
+	for paused {
+		ch := resumed
+		mux.Unlock()
+		<-ch
+		mux.Lock()
+	}
+	if limit <= 0 {
+		mux.Unlock()
+		return
+	}
+	now := time.Now()
+	if next.Before(now) {
+		next = now
+	}
+	wait := next.Sub(now)
+	next = next.Add(time.Second / time.Duration(limit))
+	mux.Unlock()
+	// short waits add up in next and are slept at once
+	if wait > time.Millisecond {
+		time.Sleep(wait)
+	}
+}
+
+type state struct {
+	Paused    bool  `json:"paused"`
+	Stopping  bool  `json:"stopping"`
+	RateLimit int64 `json:"rate_limit"`
+}
+
+// Handler serves the control API on the status port:
+//
+//	GET  /control                   the current state
+//	POST /control/pause             pause writing
+//	POST /control/resume            resume writing
+//	POST /control/rate_limit?value= set the rate limit in entries per second
+//	POST /control/stop              stop gracefully
+func Handler(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/control"), "/")
+	if action != "" && r.Method != http.MethodPost {
+		http.Error(w, "method not allowed, use POST", http.StatusMethodNotAllowed)
+		return
+	}
+	switch action {
+	case "":
+	case "pause":
+		Pause()
+	case "resume":
+		Resume()
+	case "rate_limit":
+		value, err := strconv.ParseInt(r.URL.Query().Get("value"), 10, 64)
+		if err != nil || value < 0 {
+			http.Error(w, fmt.Sprintf("invalid rate limit. value=[%s]", r.URL.Query().Get("value")), http.StatusBadRequest)
+			return
+		}
+		SetRateLimit(value)
+	case "stop":
+		Stop()
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	mux.Lock()
+	s := state{Paused: paused, Stopping: stopping, RateLimit: limit}
+	mux.Unlock()
+	w.Header().Add("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(s); err != nil {
+		log.Warnf("write control state failed, err=[%v]", err)
+	}
+}
@@ -0,0 +1,63 @@
+package control
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPause(t *testing.T) {
+	SetRateLimit(0)
+	Pause()
+	done := make(chan struct{})
+	go func() {
+		Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Wait() returned while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+	Resume()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Wait() blocked after resume")
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	SetRateLimit(100)
+	defer SetRateLimit(0)
+	start := time.Now()
+	for i := 0; i < 21; i++ {
+		Wait()
+	}
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Errorf("21 entries at 100/s took %v, want about 200ms", elapsed)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	cases := []struct {
+		method string
+		target string
+		code   int
+	}{
+		{http.MethodGet, "/control", http.StatusOK},
+		{http.MethodGet, "/control/pause", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/control/unknown", http.StatusNotFound},
+		{http.MethodPost, "/control/rate_limit?value=-1", http.StatusBadRequest},
+		{http.MethodPost, "/control/rate_limit?value=10", http.StatusOK},
+		{http.MethodPost, "/control/rate_limit?value=0", http.StatusOK},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		Handler(w, httptest.NewRequest(c.method, c.target, nil))
+		if w.Code != c.code {
+			t.Errorf("%s %s = %d, want %d", c.method, c.target, w.Code, c.code)
+		}
+	}
+}
@@ -9,6 +9,11 @@ import (
 	"RedisShake/internal/log"
 )
 
+const (
+	PhaseRDB = "rdb" // the snapshot phase: RDB, or keys scanned by scan_reader
+	PhaseAOF = "aof" // the incremental phase
+)
+
 type Entry struct {
 	DbId int      // required
 	Argv []string // required
@@ -21,6 +26,16 @@ type Entry struct {
 
 	// for stat
 	SerializedSize int64
+
+	// for entries of the snapshot (RDB or scan) phase, ValueType is empty for
+	// other entries
+	ValueType string // type of the key, such as "string" or "hash"
+	ValueSize int64  // size of the value encoded in RDB format
+	TTLMs     int64  // time to live of the key in milliseconds, -1 if it does not expire
+
+	// position in the source, Phase is empty if unknown
+	Phase  string // PhaseRDB or PhaseAOF
+	Offset int64  // bytes of the RDB read in PhaseRDB, replication offset in PhaseAOF
 }
 
 func NewEntry() *Entry {
@@ -1,57 +1,128 @@
 package filter
 
 import (
+	"RedisShake/internal/commands"
 	"RedisShake/internal/config"
 	"RedisShake/internal/entry"
-	"log"
+	"RedisShake/internal/log"
+	"RedisShake/internal/utils"
 	"slices"
 	"strings"
 )
 
+var logger = log.Component("filter")
+
+// splittableCommands apply to each key independently, so an entry with some
+// keys filtered out can be rewritten to contain only the allowed keys.
+var splittableCommands = map[string]bool{
+	"DEL":    true,
+	"UNLINK": true,
+	"TOUCH":  true,
+	"MSET":   true,
+}
+
+// splitEntry removes the keys of e that are not allowed, together with their
+// arguments. It returns false if the command of e can not be split.
+func splitEntry(e *entry.Entry, allowed []bool) bool {
+	step := commands.KeyStep(e.CmdName)
+	if !splittableCommands[e.CmdName] || step == 0 {
+		return false
+	}
+	// KeyIndexes start from 1
+	argv := append([]string{}, e.Argv[:e.KeyIndexes[0]-1]...)
+	for inx, keyInx := range e.KeyIndexes {
+		if allowed[inx] {
+			argv = append(argv, e.Argv[keyInx-1:keyInx-1+step]...)
+		}
+	}
+	logger.Debugf("split entry with filtered keys. cmd=[%s], new_cmd=[%s]", e.String(), strings.Join(argv, " "))
+	e.Argv = argv
+	e.Parse()
+	return true
+}
+
+// keyAllowed returns true if key matches any of the allow rules, or there is
+// no allow rule, matches none of the block rules, and is sampled.
+func keyAllowed(key string, slot int) bool {
+	opts := &config.Opt.Filter
+	allow := len(opts.AllowKeyPrefix) == 0 && len(opts.AllowKeySuffix) == 0 && len(allowKeyPatterns) == 0
+	for _, prefix := range opts.AllowKeyPrefix {
+		if strings.HasPrefix(key, prefix) {
+			allow = true
+		}
+	}
+	for _, suffix := range opts.AllowKeySuffix {
+		if strings.HasSuffix(key, suffix) {
+			allow = true
+		}
+	}
+	for _, pattern := range allowKeyPatterns {
+		if pattern.MatchString(key) {
+			allow = true
+		}
+	}
+	if !allow {
+		return false
+	}
+
+	for _, prefix := range opts.BlockKeyPrefix {
+		if strings.HasPrefix(key, prefix) {
+			return false
+		}
+	}
+	for _, suffix := range opts.BlockKeySuffix {
+		if strings.HasSuffix(key, suffix) {
+			return false
+		}
+	}
+	for _, pattern := range blockKeyPatterns {
+		if pattern.MatchString(key) {
+			return false
+		}
+	}
+	if sampledSlots != nil && !sampledSlots[slot] {
+		return false
+	}
+	return true
+}
+
+// valueAllowed checks the type, size and TTL of the value of an entry of the
+// snapshot phase.
+func valueAllowed(e *entry.Entry) bool {
+	opts := &config.Opt.Filter
+	if len(opts.AllowValueType) > 0 && !slices.Contains(opts.AllowValueType, e.ValueType) {
+		return false
+	}
+	if slices.Contains(opts.BlockValueType, e.ValueType) {
+		return false
+	}
+	if opts.MaxValueSize > 0 && e.ValueSize > opts.MaxValueSize {
+		return false
+	}
+	if opts.MinTTL > 0 && e.TTLMs != -1 && e.TTLMs < opts.MinTTL*1000 {
+		return false
+	}
+	return true
+}
+
 // Filter returns:
 // - true if the entry should be processed
 // - false if it should be filtered out
 func Filter(e *entry.Entry) bool {
+	// marker keys of bidirectional sync are never synced
+	for _, key := range e.Keys {
+		if utils.IsLoopMarkerKey(key) {
+			return false
+		}
+	}
+
 	keyResults := make([]bool, len(e.Keys))
 	for i := range keyResults {
 		keyResults[i] = true
 	}
 
 	for inx, key := range e.Keys {
-		// Check if the key matches any of the allowed patterns
-		allow := false
-		for _, prefix := range config.Opt.Filter.AllowKeyPrefix {
-			if strings.HasPrefix(key, prefix) {
-				allow = true
-			}
-		}
-		for _, suffix := range config.Opt.Filter.AllowKeySuffix {
-			if strings.HasSuffix(key, suffix) {
-				allow = true
-			}
-		}
-		if len(config.Opt.Filter.AllowKeyPrefix) == 0 && len(config.Opt.Filter.AllowKeySuffix) == 0 {
-			allow = true
-		}
-		if !allow {
-			keyResults[inx] = false
-		}
-
-		// Check if the key matches any of the blocked patterns
-		block := false
-		for _, prefix := range config.Opt.Filter.BlockKeyPrefix {
-			if strings.HasPrefix(key, prefix) {
-				block = true
-			}
-		}
-		for _, suffix := range config.Opt.Filter.BlockKeySuffix {
-			if strings.HasSuffix(key, suffix) {
-				block = true
-			}
-		}
-		if block {
-			keyResults[inx] = false
-		}
+		keyResults[inx] = keyAllowed(key, e.Slots[inx])
 	}
 
 	allTrue := true
@@ -70,12 +141,17 @@ func Filter(e *entry.Entry) bool {
 		// All keys are allowed, continue checking
 	} else if allFalse {
 		return false
-	} else {
+	} else if !splitEntry(e, keyResults) {
 		// If we reach here, it means some keys are true and some are false
-		log.Printf("Error: Inconsistent filter results for entry with %d keys", len(e.Keys))
-		log.Printf("Passed keys: %v", passedKeys)
-		log.Printf("Filtered keys: %v", filteredKeys)
-		return false
+		switch config.Opt.Filter.MixedKeysBehavior {
+		case "allow":
+			logger.Debugf("inconsistent filter results, allow the entry. cmd=[%s], passed_keys=%v, filtered_keys=%v", e.String(), passedKeys, filteredKeys)
+		case "panic":
+			logger.Panicf("inconsistent filter results. cmd=[%s], passed_keys=%v, filtered_keys=%v", e.String(), passedKeys, filteredKeys)
+		default:
+			logger.Warnf("inconsistent filter results, drop the entry. cmd=[%s], passed_keys=%v, filtered_keys=%v", e.String(), passedKeys, filteredKeys)
+			return false
+		}
 	}
 
 	// Check if the database matches any of the allowed databases
@@ -117,5 +193,10 @@ func Filter(e *entry.Entry) bool {
 		}
 	}
 
+	// Check the value of entries of the snapshot phase
+	if e.ValueType != "" && !valueAllowed(e) {
+		return false
+	}
+
 	return true
 }
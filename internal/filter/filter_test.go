@@ -0,0 +1,72 @@
+package filter
+
+import (
+	"strconv"
+	"testing"
+
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+)
+
+func TestFilterValue(t *testing.T) {
+	config.Opt = config.ShakeOptions{
+		Filter: config.FilterOptions{
+			BlockValueType: []string{"stream"},
+			MaxValueSize:   1024,
+			MinTTL:         10,
+		},
+	}
+	cases := []struct {
+		valueType string
+		size      int64
+		ttlMs     int64
+		allow     bool
+	}{
+		{"hash", 100, -1, true},
+		{"stream", 100, -1, false},
+		{"hash", 2048, -1, false},
+		{"hash", 100, 5000, false},
+		{"hash", 100, 20000, true},
+		{"", 4096, 0, true}, // not an entry of the snapshot phase
+	}
+	for _, c := range cases {
+		e := entry.NewEntry()
+		e.Argv = []string{"HSET", "key", "field", "value"}
+		e.Parse()
+		e.ValueType, e.ValueSize, e.TTLMs = c.valueType, c.size, c.ttlMs
+		if Filter(e) != c.allow {
+			t.Errorf("Filter(type=%s, size=%d, ttl_ms=%d) should be %v", c.valueType, c.size, c.ttlMs, c.allow)
+		}
+	}
+}
+
+func TestSample(t *testing.T) {
+	opts := defaultFilterOptions()
+	opts.SampleRatio = 0.05
+	opts.SampleSeed = 42
+	config.Opt = config.ShakeOptions{Filter: opts}
+	Init()
+	defer func() {
+		config.Opt.Filter.SampleRatio = 1
+		Init()
+	}()
+	sampled := 0
+	for i := 0; i < 100000; i++ {
+		key := "key:" + strconv.Itoa(i)
+		e := entry.NewEntry()
+		e.Argv = []string{"SET", key, "value"}
+		e.Parse()
+		allow := Filter(e)
+		e.Argv = []string{"DEL", key}
+		e.Parse()
+		if Filter(e) != allow {
+			t.Fatalf("key %s is not sampled consistently", key)
+		}
+		if allow {
+			sampled++
+		}
+	}
+	if sampled < 4000 || sampled > 6000 {
+		t.Errorf("sampled %d of 100000 keys with sample_ratio 0.05", sampled)
+	}
+}
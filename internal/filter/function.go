@@ -1,42 +1,285 @@
 package filter
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"RedisShake/internal/entry"
-	"RedisShake/internal/log"
 
 	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/ast"
 	"github.com/yuin/gopher-lua/parse"
 )
 
 type Runtime struct {
-	luaVMPool        *sync.Pool
+	current atomic.Pointer[function]
+	state   *sharedState // shake.state, kept across reloads
+
+	// for function_file
+	file      string
+	modTime   time.Time // latest modification time of the lua files when last loaded
+	reloadMux sync.Mutex
+}
+
+// function is a compiled version of the lua code with its own VMs. It is
+// replaced as a whole on reload, so entries running with the previous version
+// finish with the VMs of that version.
+type function struct {
+	luaVMPool        *vmPool
 	compiledFunction *lua.FunctionProto
+	// stateful is set if the code defines a global process(). The code and
+	// init() then run once for each VM, and process() runs for each entry.
+	stateful bool
+}
+
+// valueSizeRead is set if the current function mentions VALUE_SIZE.
+var valueSizeRead atomic.Bool
+
+// ReadsValueSize reports whether the function may read VALUE_SIZE. Measuring a
+// value keeps its commands in memory until it is read, so the snapshot readers
+// only do it when the size is used.
+func ReadsValueSize() bool {
+	return valueSizeRead.Load()
+}
+
+// vmPool keeps the idle VMs of a function. Unlike sync.Pool, it is not
+// cleared by GC, so a stateful function runs its code and init() once per VM.
+// A VM is only created when all the others are in use, so the pool holds as
+// many VMs as entries are processed concurrently, one per reader goroutine.
+type vmPool struct {
+	mux    sync.Mutex
+	idle   []*lua.LState
+	closed bool
+	new    func() *lua.LState
+}
+
+func (p *vmPool) Get() *lua.LState {
+	p.mux.Lock()
+	if n := len(p.idle); n > 0 {
+		luaState := p.idle[n-1]
+		p.idle = p.idle[:n-1]
+		p.mux.Unlock()
+		return luaState
+	}
+	p.mux.Unlock()
+	return p.new()
+}
+
+// Put returns a VM to the pool, the VM is closed if the pool is closed.
+func (p *vmPool) Put(luaState *lua.LState) {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	if p.closed {
+		luaState.Close()
+		return
+	}
+	p.idle = append(p.idle, luaState)
+}
+
+// Close closes the idle VMs, and the VMs in use when they are put back.
+func (p *vmPool) Close() {
+	p.mux.Lock()
+	defer p.mux.Unlock()
+	p.closed = true
+	for _, luaState := range p.idle {
+		luaState.Close()
+	}
+	p.idle = nil
 }
 
 func NewFunctionFilter(luaCode string) *Runtime {
 	if len(luaCode) == 0 {
 		return nil
 	}
-	luaCode = strings.TrimSpace(luaCode)
-	chunk, err := parse.Parse(strings.NewReader(luaCode), "<string>")
+	runtime := &Runtime{state: newSharedState()}
+	f, err := compileFunction(strings.TrimSpace(luaCode), "<string>", "", runtime.state)
+	if err != nil {
+		logger.Panicf(err.Error())
+	}
+	runtime.current.Store(f)
+	valueSizeRead.Store(strings.Contains(luaCode, "VALUE_SIZE"))
+	return runtime
+}
+
+// NewFunctionFilterFromFile loads the function from a lua file, which can
+// require the lua modules in the same directory.
+func NewFunctionFilterFromFile(file string) *Runtime {
+	runtime := &Runtime{file: file, state: newSharedState()}
+	if err := runtime.load(); err != nil {
+		logger.Panicf(err.Error())
+	}
+	logger.Infof("load function file. file=[%s]", file)
+	return runtime
+}
+
+func compileFunction(luaCode string, name string, luaPath string, state *sharedState) (*function, error) {
+	chunk, err := parse.Parse(strings.NewReader(luaCode), name)
 	if err != nil {
-		log.Panicf("parse lua code failed: %v", err)
+		return nil, fmt.Errorf("parse lua code failed: %v", err)
 	}
-	codeObject, err := lua.Compile(chunk, "<string>")
+	codeObject, err := lua.Compile(chunk, name)
 	if err != nil {
-		log.Panicf("compile lua code failed: %v", err)
+		return nil, fmt.Errorf("compile lua code failed: %v", err)
 	}
-	return &Runtime{
-		luaVMPool: &sync.Pool{
-			New: func() interface{} {
-				return lua.NewState()
-			},
-		},
+	f := &function{
 		compiledFunction: codeObject,
+		stateful:         definesProcess(chunk),
+	}
+	f.luaVMPool = &vmPool{
+		new: func() *lua.LState {
+			luaState, err := f.newLuaState(luaPath, state)
+			if err != nil {
+				logger.Panicf(err.Error())
+			}
+			return luaState
+		},
 	}
+	if f.stateful {
+		// report the errors of the code and init() now instead of when the
+		// first entry arrives
+		luaState, err := f.newLuaState(luaPath, state)
+		if err != nil {
+			return nil, err
+		}
+		f.luaVMPool.Put(luaState)
+	}
+	return f, nil
+}
+
+// newLuaState creates a VM for f. For a stateful function, the code and init()
+// are run in the VM.
+func (f *function) newLuaState(luaPath string, state *sharedState) (*lua.LState, error) {
+	luaState := newLuaState(luaPath, state)
+	if !f.stateful {
+		return luaState, nil
+	}
+	luaState.Push(luaState.NewFunctionFromProto(f.compiledFunction))
+	if err := luaState.PCall(0, 0, nil); err != nil {
+		luaState.Close()
+		return nil, fmt.Errorf("run lua code failed: %v", err)
+	}
+	if init := luaState.GetGlobal("init"); init != lua.LNil {
+		luaState.Push(init)
+		if err := luaState.PCall(0, 0, nil); err != nil {
+			luaState.Close()
+			return nil, fmt.Errorf("run lua init() failed: %v", err)
+		}
+	}
+	return luaState, nil
+}
+
+// definesProcess reports whether chunk assigns the global process at the top
+// level.
+func definesProcess(chunk []ast.Stmt) bool {
+	isProcess := func(expr ast.Expr) bool {
+		ident, ok := expr.(*ast.IdentExpr)
+		return ok && ident.Value == "process"
+	}
+	for _, stmt := range chunk {
+		switch s := stmt.(type) {
+		case *ast.FuncDefStmt:
+			if isProcess(s.Name.Func) {
+				return true
+			}
+		case *ast.AssignStmt:
+			for _, lhs := range s.Lhs {
+				if isProcess(lhs) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (runtime *Runtime) load() error {
+	dir := filepath.Dir(runtime.file)
+	// recorded even if the load fails, so a broken version is reported once
+	// instead of on every check of WatchFile
+	runtime.modTime = luaFilesModTime(runtime.file)
+	code, err := os.ReadFile(runtime.file)
+	if err != nil {
+		return fmt.Errorf("read function file failed: %v", err)
+	}
+	readsValueSize := bytes.Contains(code, []byte("VALUE_SIZE"))
+	// modules are compiled when they are required, check their syntax early
+	modules, _ := filepath.Glob(filepath.Join(dir, "*.lua"))
+	for _, module := range modules {
+		if module == runtime.file {
+			continue
+		}
+		moduleCode, err := os.ReadFile(module)
+		if err != nil {
+			return fmt.Errorf("read lua module failed: %v", err)
+		}
+		if _, err := parse.Parse(bytes.NewReader(moduleCode), module); err != nil {
+			return fmt.Errorf("parse lua module failed: %v", err)
+		}
+		readsValueSize = readsValueSize || bytes.Contains(moduleCode, []byte("VALUE_SIZE"))
+	}
+	luaPath := filepath.Join(dir, "?.lua") + ";" + filepath.Join(dir, "?", "init.lua")
+	f, err := compileFunction(string(code), runtime.file, luaPath, runtime.state)
+	if err != nil {
+		return err
+	}
+	if old := runtime.current.Swap(f); old != nil {
+		old.luaVMPool.Close()
+	}
+	valueSizeRead.Store(readsValueSize)
+	return nil
+}
+
+// Reload recompiles the function file and swaps it in. The previous version is
+// kept if the file can not be compiled.
+func (runtime *Runtime) Reload() {
+	runtime.reloadMux.Lock()
+	defer runtime.reloadMux.Unlock()
+	if err := runtime.load(); err != nil {
+		logger.Warnf("reload function file failed, keep the previous version. file=[%s], error=[%v]", runtime.file, err)
+		return
+	}
+	logger.Infof("reload function file. file=[%s]", runtime.file)
+}
+
+// WatchFile reloads the function file when it or a lua file in its directory
+// is modified.
+func (runtime *Runtime) WatchFile(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			runtime.reloadMux.Lock()
+			modified := !luaFilesModTime(runtime.file).Equal(runtime.modTime)
+			runtime.reloadMux.Unlock()
+			if modified {
+				runtime.Reload()
+			}
+		}
+	}
+}
+
+// luaFilesModTime returns the latest modification time of file and the lua
+// files in its directory.
+func luaFilesModTime(file string) time.Time {
+	var latest time.Time
+	files, _ := filepath.Glob(filepath.Join(filepath.Dir(file), "*.lua"))
+	for _, f := range append(files, file) {
+		info, err := os.Stat(f)
+		if err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
 }
 
 // DB
@@ -46,17 +289,27 @@ func NewFunctionFilter(luaCode string) *Runtime {
 // KEY_INDEXES
 // SLOTS
 // ARGV
+// TYPE, TTL_MS, VALUE_SIZE for entries of the snapshot phase, nil otherwise
+// PHASE ("rdb" or "aof", nil if unknown), OFFSET
 
-// shake.call(DB, ARGV)
+// shake.time(), shake.json_encode(), shake.json_decode(), shake.crc16(),
+// shake.slot(), shake.sha1(), shake.split(), shake.starts_with(),
+// shake.ends_with(), shake.trim(), shake.replace(), shake.skip_reason(),
 // shake.log()
+// shake.state.get(), shake.state.set(), shake.state.incr()
+
+// shake.call(DB, ARGV)
+
+// init() and process(), see function.stateful
 
 func (runtime *Runtime) RunFunction(e *entry.Entry) []*entry.Entry {
 	if runtime == nil {
 		return []*entry.Entry{e}
 	}
 	entries := make([]*entry.Entry, 0)
-	luaState := runtime.luaVMPool.Get().(*lua.LState)
-	defer runtime.luaVMPool.Put(luaState)
+	f := runtime.current.Load()
+	luaState := f.luaVMPool.Get()
+	defer f.luaVMPool.Put(luaState)
 	luaState.SetGlobal("DB", lua.LNumber(e.DbId))
 	luaState.SetGlobal("GROUP", lua.LString(e.Group))
 	luaState.SetGlobal("CMD", lua.LString(e.CmdName))
@@ -80,6 +333,21 @@ func (runtime *Runtime) RunFunction(e *entry.Entry) []*entry.Entry {
 		argv.Append(lua.LString(arg))
 	}
 	luaState.SetGlobal("ARGV", argv)
+	if e.ValueType != "" {
+		luaState.SetGlobal("TYPE", lua.LString(e.ValueType))
+		luaState.SetGlobal("TTL_MS", lua.LNumber(e.TTLMs))
+		luaState.SetGlobal("VALUE_SIZE", lua.LNumber(e.ValueSize))
+	} else {
+		luaState.SetGlobal("TYPE", lua.LNil)
+		luaState.SetGlobal("TTL_MS", lua.LNil)
+		luaState.SetGlobal("VALUE_SIZE", lua.LNil)
+	}
+	if e.Phase != "" {
+		luaState.SetGlobal("PHASE", lua.LString(e.Phase))
+	} else {
+		luaState.SetGlobal("PHASE", lua.LNil)
+	}
+	luaState.SetGlobal("OFFSET", lua.LNumber(e.Offset))
 	shake := luaState.NewTypeMetatable("shake")
 	luaState.SetGlobal("shake", shake)
 
@@ -96,13 +364,14 @@ func (runtime *Runtime) RunFunction(e *entry.Entry) []*entry.Entry {
 		})
 		return 0
 	}))
-	luaState.SetField(shake, "log", luaState.NewFunction(func(ls *lua.LState) int {
-		log.Infof("lua log: %v", ls.ToString(1))
-		return 0
-	}))
-	luaState.Push(luaState.NewFunctionFromProto(runtime.compiledFunction))
-	if err := luaState.PCall(0, lua.MultRet, nil); err != nil {
-		log.Panicf("load function script failed: %v", err)
+	if f.stateful {
+		luaState.Push(luaState.GetGlobal("process"))
+	} else {
+		luaState.Push(luaState.NewFunctionFromProto(f.compiledFunction))
+	}
+	if err := luaState.PCall(0, 0, nil); err != nil {
+		luaState.SetTop(0)
+		return handleFunctionError(e, err)
 	}
 
 	return entries
@@ -0,0 +1,276 @@
+package filter
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"RedisShake/internal/commands"
+	"RedisShake/internal/config"
+	"RedisShake/internal/status"
+	"RedisShake/internal/utils"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// shakeFunctions do not depend on the entry, they are registered once for
+// each VM. shake.call is set by RunFunction.
+var shakeFunctions = map[string]lua.LGFunction{
+	"time":        shakeTime,
+	"json_encode": shakeJsonEncode,
+	"json_decode": shakeJsonDecode,
+	"crc16":       shakeCrc16,
+	"slot":        shakeSlot,
+	"sha1":        shakeSha1,
+	"split":       shakeSplit,
+	"starts_with": shakeStartsWith,
+	"ends_with":   shakeEndsWith,
+	"trim":        shakeTrim,
+	"replace":     shakeReplace,
+	"skip_reason": shakeSkipReason,
+	"log":         shakeLog,
+}
+
+// sharedState is the store behind shake.state, shared by all the VMs of a
+// function. Values are copied in and out, so a table returned by
+// shake.state.get is not changed by later calls of shake.state.set.
+type sharedState struct {
+	mux    sync.Mutex
+	values map[string]interface{}
+}
+
+func newSharedState() *sharedState {
+	return &sharedState{values: make(map[string]interface{})}
+}
+
+// newLuaState creates a VM with the shake functions. luaPath is prepended to
+// package.path if it is not empty.
+func newLuaState(luaPath string, state *sharedState) *lua.LState {
+	luaState := lua.NewState()
+	shake := luaState.NewTypeMetatable("shake")
+	luaState.SetFuncs(shake, shakeFunctions)
+	luaState.SetField(shake, "state", luaState.SetFuncs(luaState.NewTable(), map[string]lua.LGFunction{
+		"get":  state.get,
+		"set":  state.set,
+		"incr": state.incr,
+	}))
+	luaState.SetGlobal("shake", shake)
+	if luaPath != "" {
+		pkg := luaState.GetGlobal("package").(*lua.LTable)
+		pkg.RawSetString("path", lua.LString(luaPath+";"+pkg.RawGetString("path").String()))
+	}
+	return luaState
+}
+
+// shake.time() returns the unix time in milliseconds.
+func shakeTime(ls *lua.LState) int {
+	ls.Push(lua.LNumber(time.Now().UnixMilli()))
+	return 1
+}
+
+// shake.json_encode(value) returns value encoded in JSON. A table is encoded as
+// an array if its keys are 1..n, as an object otherwise.
+func shakeJsonEncode(ls *lua.LState) int {
+	bytes, err := json.Marshal(luaToGo(ls.CheckAny(1)))
+	if err != nil {
+		ls.RaiseError("json_encode failed: %v", err)
+	}
+	ls.Push(lua.LString(bytes))
+	return 1
+}
+
+// shake.json_decode(str) returns the value of a JSON string, null is nil.
+func shakeJsonDecode(ls *lua.LState) int {
+	var value interface{}
+	if err := json.Unmarshal([]byte(ls.CheckString(1)), &value); err != nil {
+		ls.RaiseError("json_decode failed: %v", err)
+	}
+	ls.Push(goToLua(ls, value))
+	return 1
+}
+
+// shake.crc16(str) returns the CRC16 used by redis cluster.
+func shakeCrc16(ls *lua.LState) int {
+	ls.Push(lua.LNumber(utils.Crc16(ls.CheckString(1))))
+	return 1
+}
+
+// shake.slot(key) returns the slot of key, hash tags are respected.
+func shakeSlot(ls *lua.LState) int {
+	ls.Push(lua.LNumber(commands.CalcSlots([]string{ls.CheckString(1)})[0]))
+	return 1
+}
+
+// shake.sha1(str) returns the SHA1 of str in hex.
+func shakeSha1(ls *lua.LState) int {
+	sum := sha1.Sum([]byte(ls.CheckString(1)))
+	ls.Push(lua.LString(hex.EncodeToString(sum[:])))
+	return 1
+}
+
+// shake.split(str, sep) returns the parts of str separated by sep.
+func shakeSplit(ls *lua.LState) int {
+	table := ls.NewTable()
+	for _, part := range strings.Split(ls.CheckString(1), ls.CheckString(2)) {
+		table.Append(lua.LString(part))
+	}
+	ls.Push(table)
+	return 1
+}
+
+func shakeStartsWith(ls *lua.LState) int {
+	ls.Push(lua.LBool(strings.HasPrefix(ls.CheckString(1), ls.CheckString(2))))
+	return 1
+}
+
+func shakeEndsWith(ls *lua.LState) int {
+	ls.Push(lua.LBool(strings.HasSuffix(ls.CheckString(1), ls.CheckString(2))))
+	return 1
+}
+
+// shake.trim(str) removes the leading and trailing white spaces of str.
+func shakeTrim(ls *lua.LState) int {
+	ls.Push(lua.LString(strings.TrimSpace(ls.CheckString(1))))
+	return 1
+}
+
+// shake.replace(str, old, new) replaces all old in str by new, old is not a
+// pattern.
+func shakeReplace(ls *lua.LState) int {
+	ls.Push(lua.LString(strings.ReplaceAll(ls.CheckString(1), ls.CheckString(2), ls.CheckString(3))))
+	return 1
+}
+
+// shake.skip_reason(reason) counts the current entry as skipped for reason,
+// the counts are shown in skip_reasons of the status.
+func shakeSkipReason(ls *lua.LState) int {
+	reason := ls.CheckString(1)
+	logger.Debugf("lua skip entry. reason=[%s]", reason)
+	if config.Opt.Advanced.StatusPort != 0 {
+		status.AddSkipReason(reason)
+	}
+	return 0
+}
+
+func shakeLog(ls *lua.LState) int {
+	logger.Infof("lua log: %v", ls.ToString(1))
+	return 0
+}
+
+// shake.state.get(key) returns the value of key, nil if it is not set.
+func (state *sharedState) get(ls *lua.LState) int {
+	key := ls.CheckString(1)
+	state.mux.Lock()
+	value, ok := state.values[key]
+	state.mux.Unlock()
+	if !ok {
+		ls.Push(lua.LNil)
+		return 1
+	}
+	ls.Push(goToLua(ls, value))
+	return 1
+}
+
+// shake.state.set(key, value) sets key to value, nil deletes key.
+func (state *sharedState) set(ls *lua.LState) int {
+	key := ls.CheckString(1)
+	value := ls.Get(2)
+	state.mux.Lock()
+	defer state.mux.Unlock()
+	if value == lua.LNil {
+		delete(state.values, key)
+	} else {
+		state.values[key] = luaToGo(value)
+	}
+	return 0
+}
+
+// shake.state.incr(key[, n]) adds n (1 by default) to the number of key and
+// returns the result. A key that is not set counts as 0.
+func (state *sharedState) incr(ls *lua.LState) int {
+	key := ls.CheckString(1)
+	n := float64(ls.OptNumber(2, 1))
+	state.mux.Lock()
+	defer state.mux.Unlock()
+	var current float64
+	switch v := state.values[key].(type) {
+	case nil:
+	case int64:
+		current = float64(v)
+	case float64:
+		current = v
+	default:
+		ls.RaiseError("shake.state.incr: value of %s is not a number", key)
+	}
+	result := lua.LNumber(current + n)
+	state.values[key] = luaToGo(result)
+	ls.Push(result)
+	return 1
+}
+
+func luaToGo(value lua.LValue) interface{} {
+	switch v := value.(type) {
+	case lua.LBool:
+		return bool(v)
+	case lua.LNumber:
+		f := float64(v)
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return int64(f)
+		}
+		return f
+	case lua.LString:
+		return string(v)
+	case *lua.LTable:
+		if n := v.MaxN(); n > 0 && n == v.Len() && countTableKeys(v) == n {
+			array := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				array = append(array, luaToGo(v.RawGetInt(i)))
+			}
+			return array
+		}
+		object := make(map[string]interface{})
+		v.ForEach(func(key lua.LValue, value lua.LValue) {
+			object[key.String()] = luaToGo(value)
+		})
+		return object
+	}
+	return nil
+}
+
+func countTableKeys(table *lua.LTable) int {
+	count := 0
+	table.ForEach(func(lua.LValue, lua.LValue) {
+		count++
+	})
+	return count
+}
+
+func goToLua(ls *lua.LState, value interface{}) lua.LValue {
+	switch v := value.(type) {
+	case bool:
+		return lua.LBool(v)
+	case int64:
+		return lua.LNumber(v)
+	case float64:
+		return lua.LNumber(v)
+	case string:
+		return lua.LString(v)
+	case []interface{}:
+		table := ls.NewTable()
+		for _, item := range v {
+			table.Append(goToLua(ls, item))
+		}
+		return table
+	case map[string]interface{}:
+		table := ls.NewTable()
+		for key, item := range v {
+			table.RawSetString(key, goToLua(ls, item))
+		}
+		return table
+	}
+	return lua.LNil
+}
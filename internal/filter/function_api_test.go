@@ -0,0 +1,179 @@
+package filter
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	goruntime "runtime"
+	"strings"
+	"testing"
+
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestFunctionAPI(t *testing.T) {
+	runtime := NewFunctionFilter(`
+		local value = shake.json_decode(ARGV[3])
+		value.tags = shake.split(value.name, ":")
+		value.name = nil
+		local out = {
+			shake.json_encode(value),
+			tostring(shake.slot("{user1}:a") == shake.slot("user1")),
+			tostring(shake.crc16("123456789")),
+			shake.sha1("abc"),
+			tostring(shake.starts_with(KEYS[1], "user")),
+			tostring(shake.ends_with(KEYS[1], "x")),
+			shake.trim("  a  "),
+			shake.replace("a.b.c", ".", "-"),
+			PHASE,
+			tostring(OFFSET),
+			tostring(shake.time() > 0),
+		}
+		shake.call(DB, out)
+	`)
+	e := entry.NewEntry()
+	e.Argv = []string{"SET", "user:1", `{"name":"a:b","n":1}`}
+	e.Phase = entry.PhaseAOF
+	e.Offset = 100
+	e.Parse()
+	entries := runtime.RunFunction(e)
+	if len(entries) != 1 {
+		t.Fatalf("RunFunction returned %d entries", len(entries))
+	}
+	got := strings.Join(entries[0].Argv, " ")
+	want := `{"n":1,"tags":["a","b"]} true 12739 a9993e364706816aba3e25717850c26c9cd0d89d true false a a-b-c aof 100 true`
+	if got != want {
+		t.Errorf("RunFunction got %s, want %s", got, want)
+	}
+}
+
+func TestFunctionFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "main.lua")
+	writeFile := func(name string, code string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(code), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeFile("prefix.lua", `return { add = function(key) return "v1:" .. key end }`)
+	writeFile("main.lua", `local prefix = require("prefix") shake.call(DB, {ARGV[1], prefix.add(KEYS[1])})`)
+	runtime := NewFunctionFilterFromFile(file)
+	run := func() string {
+		e := entry.NewEntry()
+		e.Argv = []string{"DEL", "key"}
+		e.Parse()
+		return strings.Join(runtime.RunFunction(e)[0].Argv, " ")
+	}
+	if got := run(); got != "DEL v1:key" {
+		t.Errorf("RunFunction got %s", got)
+	}
+	old := runtime.current.Load().luaVMPool
+	var oldVM *lua.LState = old.Get()
+	old.Put(oldVM)
+	writeFile("prefix.lua", `return { add = function(key) return "v2:" .. key end }`)
+	runtime.Reload()
+	if !oldVM.IsClosed() {
+		t.Errorf("the VMs of the previous version should be closed after reload")
+	}
+	if got := run(); got != "DEL v2:key" {
+		t.Errorf("RunFunction after reload got %s", got)
+	}
+	writeFile("prefix.lua", `return {`) // syntax error keeps the previous version
+	runtime.Reload()
+	if got := run(); got != "DEL v2:key" {
+		t.Errorf("RunFunction after failed reload got %s", got)
+	}
+	if !runtime.modTime.Equal(luaFilesModTime(file)) {
+		t.Errorf("a failed reload should be recorded, so WatchFile does not retry it")
+	}
+}
+
+func TestFunctionError(t *testing.T) {
+	deadLetterFile := filepath.Join(t.TempDir(), "dead_letter.jsonl")
+	config.Opt = config.ShakeOptions{
+		Filter: config.FilterOptions{FunctionDeadLetterFile: deadLetterFile},
+	}
+	runtime := NewFunctionFilter(`error("boom")`)
+	run := func(behavior string) []*entry.Entry {
+		config.Opt.Filter.FunctionErrorBehavior = behavior
+		e := entry.NewEntry()
+		e.Argv = []string{"SET", "key", "\xff\x00value"} // not valid UTF-8
+		e.Parse()
+		return runtime.RunFunction(e)
+	}
+	if entries := run("pass"); len(entries) != 1 || entries[0].Argv[0] != "SET" {
+		t.Errorf("pass should write the original entry, got %v", entries)
+	}
+	if entries := run("drop"); len(entries) != 0 {
+		t.Errorf("drop should drop the entry, got %v", entries)
+	}
+	if entries := run("dead_letter"); len(entries) != 0 {
+		t.Errorf("dead_letter should drop the entry, got %v", entries)
+	}
+	CloseDeadLetterFile()
+	content, err := os.ReadFile(deadLetterFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var line struct {
+		Argv  [][]byte `json:"argv"`
+		Error string   `json:"error"`
+	}
+	if err := json.Unmarshal(content, &line); err != nil {
+		t.Fatal(err)
+	}
+	if len(line.Argv) != 3 || string(line.Argv[2]) != "\xff\x00value" || !strings.Contains(line.Error, "boom") {
+		t.Errorf("unexpected dead letter file: %s", content)
+	}
+}
+
+func TestFunctionState(t *testing.T) {
+	runtime := NewFunctionFilter(`
+		local tenants
+		function init()
+			tenants = {old1 = "new1", old2 = "new2"}
+			shake.state.incr("vms")
+		end
+		function process()
+			local count = shake.state.incr("entries")
+			shake.state.set("last", {key = KEYS[1], count = count})
+			local tenant, rest = string.match(KEYS[1], "^(%w+):(.*)$")
+			shake.call(DB, {CMD, (tenants[tenant] or tenant) .. ":" .. rest, ARGV[3]})
+			return count
+		end
+	`)
+	for i, key := range []string{"old1:a", "old2:b", "old3:c"} {
+		goruntime.GC() // a sync.Pool would drop its VMs
+		goruntime.GC()
+		e := entry.NewEntry()
+		e.Argv = []string{"SET", key, "value"}
+		e.Parse()
+		entries := runtime.RunFunction(e)
+		want := []string{"SET new1:a value", "SET new2:b value", "SET old3:c value"}[i]
+		if len(entries) != 1 || strings.Join(entries[0].Argv, " ") != want {
+			t.Errorf("RunFunction(%s) = %v, want %s", key, entries, want)
+		}
+	}
+	luaState := runtime.current.Load().luaVMPool.Get()
+	if top := luaState.GetTop(); top != 0 {
+		t.Errorf("the values returned by process() are left on the stack of the VM. top=[%d]", top)
+	}
+	state := runtime.state.values
+	if state["entries"] != int64(3) || state["vms"] != int64(1) { // init() runs once, even after GC
+		t.Errorf("unexpected counters. state=%v", state)
+	}
+	if last := state["last"].(map[string]interface{}); last["key"] != "old3:c" || last["count"] != int64(3) {
+		t.Errorf("unexpected last. last=%v", last)
+	}
+
+	_, err := compileFunction(`
+		function init() error("boom") end
+		function process() end
+	`, "<string>", "", newSharedState())
+	if err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("an error in init() should be reported when the function is compiled. error=[%v]", err)
+	}
+}
@@ -0,0 +1,110 @@
+package filter
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+	"RedisShake/internal/status"
+)
+
+var deadLetter struct {
+	mux  sync.Mutex
+	file *os.File
+}
+
+// a function that fails for every key would log a line per key, so failures
+// are logged at most once per functionErrorLogInterval
+const functionErrorLogInterval = 10 * time.Second
+
+var functionErrorLog struct {
+	mux     sync.Mutex
+	last    time.Time
+	skipped int64 // failures not logged since the last warning
+}
+
+// handleFunctionError applies function_error_behavior to an entry whose
+// function raised err, and returns the entries to be written.
+func handleFunctionError(e *entry.Entry, err error) []*entry.Entry {
+	if config.Opt.Advanced.StatusPort != 0 {
+		status.AddFunctionError(err.Error())
+	}
+	switch config.Opt.Filter.FunctionErrorBehavior {
+	case "pass":
+		warnFunctionError("pass the entry", e, err)
+		return []*entry.Entry{e}
+	case "drop":
+		warnFunctionError("drop the entry", e, err)
+		return []*entry.Entry{}
+	case "dead_letter":
+		warnFunctionError("write the entry to dead letter file", e, err)
+		writeDeadLetter(e, err)
+		return []*entry.Entry{}
+	default:
+		logger.Panicf("run function failed. cmd=[%s], error=[%v]", e.String(), err)
+		return nil
+	}
+}
+
+func warnFunctionError(action string, e *entry.Entry, err error) {
+	functionErrorLog.mux.Lock()
+	defer functionErrorLog.mux.Unlock()
+	if time.Since(functionErrorLog.last) < functionErrorLogInterval {
+		functionErrorLog.skipped++
+		return
+	}
+	logger.Warnf("run function failed, %s. cmd=[%s], error=[%v], failures_not_logged=[%d]", action, e.String(), err, functionErrorLog.skipped)
+	functionErrorLog.last = time.Now()
+	functionErrorLog.skipped = 0
+}
+
+// writeDeadLetter appends e to function_dead_letter_file as a line of JSON.
+// The arguments are encoded in base64, as values of the snapshot phase may not
+// be valid UTF-8.
+func writeDeadLetter(e *entry.Entry, err error) {
+	argv := make([][]byte, len(e.Argv))
+	for inx, arg := range e.Argv {
+		argv[inx] = []byte(arg)
+	}
+	line, jsonErr := json.Marshal(struct {
+		Time  string   `json:"time"`
+		Db    int      `json:"db"`
+		Argv  [][]byte `json:"argv"`
+		Error string   `json:"error"`
+	}{time.Now().Format(time.RFC3339), e.DbId, argv, err.Error()})
+	if jsonErr != nil {
+		logger.Panicf("marshal dead letter failed. error=[%v]", jsonErr)
+	}
+	deadLetter.mux.Lock()
+	defer deadLetter.mux.Unlock()
+	if deadLetter.file == nil {
+		file, openErr := os.OpenFile(config.Opt.Filter.FunctionDeadLetterFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if openErr != nil {
+			logger.Panicf("open dead letter file failed. file=[%s], error=[%v]", config.Opt.Filter.FunctionDeadLetterFile, openErr)
+		}
+		deadLetter.file = file
+	}
+	if _, writeErr := deadLetter.file.Write(append(line, '\n')); writeErr != nil {
+		logger.Panicf("write dead letter file failed. file=[%s], error=[%v]", config.Opt.Filter.FunctionDeadLetterFile, writeErr)
+	}
+}
+
+// CloseDeadLetterFile syncs and closes function_dead_letter_file if entries
+// were written to it.
+func CloseDeadLetterFile() {
+	deadLetter.mux.Lock()
+	defer deadLetter.mux.Unlock()
+	if deadLetter.file == nil {
+		return
+	}
+	if err := deadLetter.file.Sync(); err != nil {
+		logger.Warnf("sync dead letter file failed. file=[%s], error=[%v]", config.Opt.Filter.FunctionDeadLetterFile, err)
+	}
+	if err := deadLetter.file.Close(); err != nil {
+		logger.Warnf("close dead letter file failed. file=[%s], error=[%v]", config.Opt.Filter.FunctionDeadLetterFile, err)
+	}
+	deadLetter.file = nil
+}
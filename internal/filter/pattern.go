@@ -0,0 +1,109 @@
+package filter
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"RedisShake/internal/config"
+)
+
+var (
+	allowKeyPatterns []*regexp.Regexp
+	blockKeyPatterns []*regexp.Regexp
+)
+
+// Init validates and prepares the [filter] options, such as the key regex and
+// glob patterns, it must be called once after the config is loaded.
+func Init() {
+	opts := &config.Opt.Filter
+	allowKeyPatterns = append(compileKeyRegex("allow_key_regex", opts.AllowKeyRegex), compileKeyGlob("allow_key_glob", opts.AllowKeyGlob)...)
+	blockKeyPatterns = append(compileKeyRegex("block_key_regex", opts.BlockKeyRegex), compileKeyGlob("block_key_glob", opts.BlockKeyGlob)...)
+	if !slices.Contains([]string{"drop", "allow", "panic"}, opts.MixedKeysBehavior) {
+		logger.Panicf("invalid mixed_keys_behavior. mixed_keys_behavior=[%s]", opts.MixedKeysBehavior)
+	}
+	initSample()
+	if !slices.Contains([]string{"panic", "pass", "drop", "dead_letter"}, opts.FunctionErrorBehavior) {
+		logger.Panicf("invalid function_error_behavior. function_error_behavior=[%s]", opts.FunctionErrorBehavior)
+	}
+}
+
+func compileKeyRegex(option string, patterns []string) []*regexp.Regexp {
+	ret := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			logger.Panicf("invalid %s. pattern=[%s], error=[%v]", option, pattern, err)
+		}
+		ret = append(ret, re)
+	}
+	return ret
+}
+
+func compileKeyGlob(option string, patterns []string) []*regexp.Regexp {
+	ret := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(globToRegex(pattern))
+		if err != nil {
+			logger.Panicf("invalid %s. pattern=[%s], error=[%v]", option, pattern, err)
+		}
+		ret = append(ret, re)
+	}
+	return ret
+}
+
+// globToRegex converts a glob-style pattern of the KEYS command to an anchored
+// regular expression. A star matches any sequence of characters, including an
+// empty one, and a question mark matches any single character. [ae] matches a
+// or e, [^e] matches anything but e and [a-c] matches a, b or c. \x matches x
+// literally.
+func globToRegex(pattern string) string {
+	var buf strings.Builder
+	buf.WriteString(`(?s)^`)
+	for inx := 0; inx < len(pattern); inx++ {
+		c := pattern[inx]
+		switch c {
+		case '*':
+			buf.WriteString(".*")
+		case '?':
+			buf.WriteString(".")
+		case '\\':
+			if inx+1 < len(pattern) {
+				inx++
+			}
+			buf.WriteString(regexp.QuoteMeta(pattern[inx : inx+1]))
+		case '[':
+			end := strings.IndexByte(pattern[inx+1:], ']')
+			if end == -1 { // no closing bracket, match it literally
+				buf.WriteString(`\[`)
+				continue
+			}
+			class := pattern[inx+1 : inx+1+end]
+			buf.WriteString("[")
+			if strings.HasPrefix(class, "^") {
+				buf.WriteString("^")
+				class = class[1:]
+			}
+			for i := 0; i < len(class); i++ {
+				c := class[i]
+				if c == '\\' && i+1 < len(class) {
+					i++
+					c = class[i]
+				} else if c == '-' && i > 0 && i+1 < len(class) {
+					buf.WriteByte('-') // range
+					continue
+				}
+				if strings.IndexByte(`\-[]^`, c) != -1 {
+					buf.WriteByte('\\')
+				}
+				buf.WriteByte(c)
+			}
+			buf.WriteString("]")
+			inx += end + 1
+		default:
+			buf.WriteString(regexp.QuoteMeta(pattern[inx : inx+1]))
+		}
+	}
+	buf.WriteString("$")
+	return buf.String()
+}
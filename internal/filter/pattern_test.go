@@ -0,0 +1,87 @@
+package filter
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+
+	"github.com/mcuadros/go-defaults"
+)
+
+func TestGlobToRegex(t *testing.T) {
+	cases := []struct {
+		glob  string
+		key   string
+		match bool
+	}{
+		{"user:*:session", "user:42:session", true},
+		{"user:*:session", "user::session", true},
+		{"user:*:session", "user:42:sessions", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "heello", false},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-c]llo", "hbllo", true},
+		{"h[a-c]llo", "hdllo", false},
+		{`h\*llo`, "h*llo", true},
+		{`h\*llo`, "hello", false},
+		{"a.b(c)+", "a.b(c)+", true},
+		{"a.b(c)+", "axb(c)", false},
+		{"[abc", "[abc", true},
+		{"*", "line1\nline2", true},
+	}
+	for _, c := range cases {
+		re := regexp.MustCompile(globToRegex(c.glob))
+		if re.MatchString(c.key) != c.match {
+			t.Errorf("glob %s match %q should be %v, regex=[%s]", c.glob, c.key, c.match, globToRegex(c.glob))
+		}
+	}
+}
+
+// defaultFilterOptions returns the filter options of a config file without a
+// [filter] section, so that tests only set the options they are about.
+func defaultFilterOptions() config.FilterOptions {
+	opts := config.FilterOptions{}
+	defaults.SetDefaults(&opts)
+	return opts
+}
+
+func TestFilterKeyPatterns(t *testing.T) {
+	opts := defaultFilterOptions()
+	opts.AllowKeyRegex = []string{"^tenant-(12|47):"}
+	opts.AllowKeyGlob = []string{"user:*:session"}
+	opts.BlockKeyGlob = []string{"*:tmp"}
+	config.Opt = config.ShakeOptions{Filter: opts}
+	Init()
+	cases := []struct {
+		argv  string
+		allow bool
+		want  string
+	}{
+		{"SET tenant-12:a 1", true, ""},
+		{"SET tenant-13:a 1", false, ""},
+		{"SET user:1:session 1", true, ""},
+		{"SET tenant-47:tmp 1", false, ""},
+		{"MSET tenant-12:a 1 user:1:session 2", true, ""},
+		{"MSET tenant-12:a 1 tenant-13:a 2 user:2:session 3", true, "MSET tenant-12:a 1 user:2:session 3"},
+		{"DEL a:tmp tenant-12:a b", true, "DEL tenant-12:a"},
+		{"RENAME tenant-12:a tenant-13:a", false, ""}, // can not be split
+		{"PING", true, ""},
+	}
+	for _, c := range cases {
+		e := entry.NewEntry()
+		e.Argv = strings.Split(c.argv, " ")
+		e.Parse()
+		if Filter(e) != c.allow {
+			t.Errorf("Filter(%s) should be %v", c.argv, c.allow)
+		}
+		if got := strings.Join(e.Argv, " "); c.want != "" && got != c.want {
+			t.Errorf("Filter(%s) should split the entry into %s, got %s", c.argv, c.want, got)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package filter
+
+import (
+	"RedisShake/internal/config"
+)
+
+// sampledSlots is nil if all keys are sampled, otherwise keys are sampled by
+// their slots, so the same keys are selected in every phase and every run,
+// and keys sharing a hash tag are selected together.
+var sampledSlots []bool
+
+func initSample() {
+	ratio := config.Opt.Filter.SampleRatio
+	if ratio <= 0 || ratio > 1 {
+		logger.Panicf("sample_ratio must be in (0, 1]. sample_ratio=[%v]", ratio)
+	}
+	sampledSlots = nil
+	if ratio == 1 {
+		return
+	}
+	sampledSlots = make([]bool, 16384)
+	count := 0
+	for slot := range sampledSlots {
+		sampledSlots[slot] = sampleHash(uint64(slot), uint64(config.Opt.Filter.SampleSeed)) < ratio
+		if sampledSlots[slot] {
+			count++
+		}
+	}
+	logger.Infof("sample keys of %d slots. sample_ratio=[%v], sample_seed=[%d]", count, ratio, config.Opt.Filter.SampleSeed)
+}
+
+// sampleHash maps slot and seed to a number in [0, 1) using the finalizer of
+// splitmix64.
+func sampleHash(slot uint64, seed uint64) float64 {
+	h := slot ^ (seed * 0x9e3779b97f4a7c15)
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return float64(h>>11) / (1 << 53)
+}
@@ -0,0 +1,166 @@
+package hook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"sync"
+	"time"
+
+	"RedisShake/internal/config"
+	"RedisShake/internal/log"
+)
+
+// lifecycle events
+const (
+	HandshakeDone     = "handshake_done"      // the source accepts the sync
+	RdbReceived       = "rdb_received"        // the RDB is received from the source
+	RdbApplied        = "rdb_applied"         // the RDB is parsed and sent to the writer
+	FirstConsistent   = "first_consistent"    // the destination catches up with the source for the first time
+	LagAboveThreshold = "lag_above_threshold" // the replication lag exceeds lag_threshold
+	FatalError        = "fatal_error"         // redis-shake exits on an error
+)
+
+var events = []string{HandshakeDone, RdbReceived, RdbApplied, FirstConsistent, LagAboveThreshold, FatalError}
+
+type Event struct {
+	Event   string `json:"event"`
+	Time    string `json:"time"`
+	Name    string `json:"name,omitempty"` // the reader triggering the event, e.g. a shard of a cluster
+	Message string `json:"message,omitempty"`
+}
+
+// The events are run one by one in the order they are triggered.
+var (
+	ch      chan *Event
+	pending sync.WaitGroup
+	enabled map[string]bool
+	client  *http.Client
+	timeout time.Duration
+
+	mux    sync.Mutex // guards pending.Add against pending.Wait in fatal
+	closed bool       // no more events after the fatal error
+)
+
+func Init() {
+	opts := &config.Opt.Hook
+	for _, event := range opts.Events {
+		if !slices.Contains(events, event) {
+			log.Panicf("unknown hook event. event=[%s], events=%v", event, events)
+		}
+	}
+	if opts.Command == "" && opts.Webhook == "" {
+		return
+	}
+	enabled = make(map[string]bool)
+	for _, event := range events {
+		enabled[event] = len(opts.Events) == 0 || slices.Contains(opts.Events, event)
+	}
+	timeout = time.Duration(opts.Timeout) * time.Second
+	client = &http.Client{Timeout: timeout}
+	ch = make(chan *Event, 1024)
+	go func() {
+		for e := range ch {
+			run(e)
+			pending.Done()
+		}
+	}()
+	log.SetFatalHook(fatal)
+	log.Infof("hook enabled. command=[%s], webhook=[%s], events=%v", opts.Command, opts.Webhook, opts.Events)
+}
+
+// Enabled returns whether event triggers the hook, so that the caller can skip
+// the work of detecting it.
+func Enabled(event string) bool {
+	return enabled[event]
+}
+
+// Trigger runs the hook for event in the background.
+func Trigger(event string, name string, format string, args ...interface{}) {
+	if !enabled[event] {
+		return
+	}
+	mux.Lock()
+	defer mux.Unlock()
+	if closed {
+		return
+	}
+	e := &Event{
+		Event:   event,
+		Time:    time.Now().Format(time.RFC3339),
+		Name:    name,
+		Message: fmt.Sprintf(format, args...),
+	}
+	pending.Add(1)
+	select {
+	case ch <- e:
+	default:
+		pending.Done()
+		log.Warnf("too many pending hook events, drop the event. event=[%s], name=[%s]", event, name)
+	}
+}
+
+var fatalOnce sync.Once
+
+// fatal runs the hook for the fatal error and waits for the pending events
+// before redis-shake exits.
+func fatal(msg string) {
+	fatalOnce.Do(func() {
+		Trigger(FatalError, "", "%s", msg)
+		mux.Lock()
+		closed = true
+		mux.Unlock()
+		done := make(chan struct{})
+		go func() {
+			pending.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(2 * timeout):
+		}
+	})
+}
+
+func run(e *Event) {
+	opts := &config.Opt.Hook
+	if opts.Command != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		cmd := exec.CommandContext(ctx, "sh", "-c", opts.Command)
+		cmd.Env = append(os.Environ(),
+			"SHAKE_EVENT="+e.Event,
+			"SHAKE_TIME="+e.Time,
+			"SHAKE_NAME="+e.Name,
+			"SHAKE_MESSAGE="+e.Message)
+		output, err := cmd.CombinedOutput()
+		cancel()
+		if err != nil {
+			log.Warnf("run hook command failed. event=[%s], error=[%v], output=[%s]", e.Event, err, output)
+		} else {
+			log.Infof("run hook command. event=[%s], name=[%s]", e.Event, e.Name)
+		}
+	}
+	if opts.Webhook != "" {
+		body, err := json.Marshal(e)
+		if err != nil {
+			log.Warnf("marshal hook event failed. event=[%s], error=[%v]", e.Event, err)
+			return
+		}
+		resp, err := client.Post(opts.Webhook, "application/json", bytes.NewReader(body))
+		if err != nil {
+			log.Warnf("post hook webhook failed. event=[%s], error=[%v]", e.Event, err)
+			return
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			log.Warnf("post hook webhook failed. event=[%s], status=[%s]", e.Event, resp.Status)
+			return
+		}
+		log.Infof("post hook webhook. event=[%s], name=[%s]", e.Event, e.Name)
+	}
+}
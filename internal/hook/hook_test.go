@@ -0,0 +1,55 @@
+package hook
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"RedisShake/internal/config"
+)
+
+func TestHook(t *testing.T) {
+	received := make(chan Event, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var e Event
+		if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+			t.Errorf("decode webhook body failed: %v", err)
+		}
+		received <- e
+	}))
+	defer server.Close()
+
+	output := filepath.Join(t.TempDir(), "events")
+	config.Opt.Hook = config.HookOptions{
+		Command: `echo "$SHAKE_EVENT $SHAKE_NAME $SHAKE_MESSAGE" >> ` + output,
+		Webhook: server.URL,
+		Events:  []string{RdbReceived, FatalError},
+		Timeout: 5,
+	}
+	Init()
+	defer func() { enabled = nil }()
+
+	Trigger(HandshakeDone, "reader_1", "not enabled")
+	Trigger(RdbReceived, "reader_1", "size=[%s]", "1.0 KiB")
+	fatal("fatal")
+	fatal("only once")
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "rdb_received reader_1 size=[1.0 KiB]\nfatal_error  fatal\n"; string(data) != want {
+		t.Errorf("command output = %q, want %q", data, want)
+	}
+	close(received)
+	var got []string
+	for e := range received {
+		got = append(got, e.Event+" "+e.Name+" "+e.Message)
+	}
+	if len(got) != 2 || got[0] != "rdb_received reader_1 size=[1.0 KiB]" || got[1] != "fatal_error  fatal" {
+		t.Errorf("webhook events = %q", got)
+	}
+}
@@ -6,21 +6,50 @@ import (
 	"strings"
 
 	"github.com/go-stack/stack"
+	"github.com/rs/zerolog"
 )
 
-func Debugf(format string, args ...interface{}) {
-	logger.Debug().Msgf(format, args...)
+// Logger is the logger of a component. Its level is set by log_levels and
+// falls back to log_level.
+type Logger struct {
+	name   string
+	logger zerolog.Logger
 }
 
-func Infof(format string, args ...interface{}) {
-	logger.Info().Msgf(format, args...)
+var components = make(map[string]*Logger)
+
+// Component returns the logger of the component name, it is usable once Init
+// is called.
+func Component(name string) *Logger {
+	if l, ok := components[name]; ok {
+		return l
+	}
+	l := &Logger{name: name}
+	components[name] = l
+	return l
 }
 
-func Warnf(format string, args ...interface{}) {
-	logger.Warn().Msgf(format, args...)
+func (l *Logger) Tracef(format string, args ...interface{}) {
+	l.logger.Trace().Msgf(format, args...)
 }
 
-func Panicf(format string, args ...interface{}) {
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	l.logger.Debug().Msgf(format, args...)
+}
+
+func (l *Logger) Infof(format string, args ...interface{}) {
+	l.logger.Info().Msgf(format, args...)
+}
+
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	l.logger.Warn().Msgf(format, args...)
+}
+
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	l.logger.Error().Msgf(format, args...)
+}
+
+func (l *Logger) Panicf(format string, args ...interface{}) {
 	frames := stack.Trace()
 	errMsg := fmt.Sprintf(format, args...)
 	for _, frame := range frames {
@@ -33,6 +62,45 @@ func Panicf(format string, args ...interface{}) {
 		}
 		errMsg += fmt.Sprintf("\n\t\t\t%v -> %n()", frameStr, frame)
 	}
-	logger.Error().Msgf(errMsg)
+	l.logger.Error().Msgf(errMsg)
+	if fatalHook != nil {
+		fatalHook(fmt.Sprintf(format, args...))
+	}
 	os.Exit(1)
 }
+
+// fatalHook is called with the message of Panicf before exiting.
+var fatalHook func(msg string)
+
+// SetFatalHook sets the function called with the message of Panicf before
+// exiting, it must not call Panicf.
+func SetFatalHook(hook func(msg string)) {
+	fatalHook = hook
+}
+
+// the logger of the components without their own
+var logger = &Logger{}
+
+func Tracef(format string, args ...interface{}) {
+	logger.Tracef(format, args...)
+}
+
+func Debugf(format string, args ...interface{}) {
+	logger.Debugf(format, args...)
+}
+
+func Infof(format string, args ...interface{}) {
+	logger.Infof(format, args...)
+}
+
+func Warnf(format string, args ...interface{}) {
+	logger.Warnf(format, args...)
+}
+
+func Errorf(format string, args ...interface{}) {
+	logger.Errorf(format, args...)
+}
+
+func Panicf(format string, args ...interface{}) {
+	logger.Panicf(format, args...)
+}
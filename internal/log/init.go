@@ -2,29 +2,53 @@ package log
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/rs/zerolog"
 )
 
-var logger zerolog.Logger
+type Options struct {
+	Level  string            // trace, debug, info, warn or error
+	Levels map[string]string // levels of the components, e.g. reader = "debug"
+	Format string            // format of stdout, console or json, the log file is always in json
 
-func Init(level string, file string, dir string) {
-	// log level
+	Dir  string
+	File string
+
+	// rotation of the log file, 0 means disabled
+	MaxSize        int // megabytes
+	RotateInterval int // hours
+	MaxBackups     int
+	MaxAge         int // days
+}
+
+func parseLevel(level string) zerolog.Level {
 	switch level {
+	case "trace":
+		return zerolog.TraceLevel
 	case "debug":
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		return zerolog.DebugLevel
 	case "info":
-		zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		return zerolog.InfoLevel
 	case "warn":
-		zerolog.SetGlobalLevel(zerolog.WarnLevel)
+		return zerolog.WarnLevel
+	case "error":
+		return zerolog.ErrorLevel
 	default:
 		panic(fmt.Sprintf("unknown log level: %s", level))
 	}
+}
+
+func Init(opts Options) {
+	// log level, the level of each logger is set below
+	level := parseLevel(opts.Level)
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
 
 	// dir
-	dir, err := filepath.Abs(dir)
+	dir, err := filepath.Abs(opts.Dir)
 	if err != nil {
 		panic(fmt.Sprintf("failed to determine current directory: %v", err))
 	}
@@ -34,15 +58,40 @@ func Init(level string, file string, dir string) {
 			panic(fmt.Sprintf("mkdir failed. dir=[%s], error=[%v]", dir, err))
 		}
 	}
-	path := filepath.Join(dir, file)
+	path := filepath.Join(dir, opts.File)
+
+	// stdout
+	var stdoutWriter io.Writer
+	switch opts.Format {
+	case "console":
+		stdoutWriter = zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: "2006-01-02 15:04:05"}
+	case "json":
+		stdoutWriter = os.Stdout
+	default:
+		panic(fmt.Sprintf("unknown log format: %s", opts.Format))
+	}
 
 	// log file
-	consoleWriter := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: "2006-01-02 15:04:05"}
-	fileWriter, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	fileWriter, err := newRotateWriter(path, int64(opts.MaxSize)*1024*1024,
+		time.Duration(opts.RotateInterval)*time.Hour, opts.MaxBackups, time.Duration(opts.MaxAge)*24*time.Hour)
 	if err != nil {
 		panic(fmt.Sprintf("open log file failed. file=[%s], err=[%s]", path, err))
 	}
-	multi := zerolog.MultiLevelWriter(consoleWriter, fileWriter)
-	logger = zerolog.New(multi).With().Timestamp().Logger()
-	Infof("log_level: [%v], log_file: [%v]", level, path)
+	multi := zerolog.MultiLevelWriter(stdoutWriter, fileWriter)
+	base := zerolog.New(multi).With().Timestamp().Logger()
+	logger.logger = base.Level(level)
+	for name, componentLevel := range opts.Levels {
+		if _, ok := components[name]; !ok {
+			panic(fmt.Sprintf("unknown log component: %s", name))
+		}
+		parseLevel(componentLevel)
+	}
+	for name, l := range components {
+		lvl := level
+		if componentLevel, ok := opts.Levels[name]; ok {
+			lvl = parseLevel(componentLevel)
+		}
+		l.logger = base.With().Str("component", name).Logger().Level(lvl)
+	}
+	Infof("log_level: [%v], log_levels: %v, log_format: [%v], log_file: [%v]", opts.Level, opts.Levels, opts.Format, path)
 }
@@ -0,0 +1,127 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// rotateWriter appends to the log file and rotates it when it exceeds maxSize
+// or has been written for interval. A rotated file is renamed like
+// shake.2006-01-02T15-04-05.000.log, and is removed once there are more than
+// maxBackups rotated files or it is older than maxAge.
+type rotateWriter struct {
+	mux        sync.Mutex
+	path       string
+	file       *os.File
+	size       int64
+	opened     time.Time
+	maxSize    int64         // bytes, 0 means no limit
+	interval   time.Duration // 0 means no limit
+	maxBackups int           // 0 means no limit
+	maxAge     time.Duration // 0 means no limit
+}
+
+func newRotateWriter(path string, maxSize int64, interval time.Duration, maxBackups int, maxAge time.Duration) (*rotateWriter, error) {
+	w := &rotateWriter{path: path, maxSize: maxSize, interval: interval, maxBackups: maxBackups, maxAge: maxAge}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	w.removeBackups()
+	return w, nil
+}
+
+func (w *rotateWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	w.opened = time.Now()
+	return nil
+}
+
+func (w *rotateWriter) Write(p []byte) (int, error) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+	if w.needRotate(int64(len(p))) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotateWriter) needRotate(writeSize int64) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.maxSize > 0 && w.size+writeSize > w.maxSize {
+		return true
+	}
+	return w.interval > 0 && time.Since(w.opened) >= w.interval
+}
+
+func (w *rotateWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(w.path, w.backupPath(time.Now())); err != nil {
+		return err
+	}
+	if err := w.open(); err != nil {
+		return err
+	}
+	w.removeBackups()
+	return nil
+}
+
+func (w *rotateWriter) backupPath(t time.Time) string {
+	ext := filepath.Ext(w.path)
+	return strings.TrimSuffix(w.path, ext) + "." + t.Format(backupTimeFormat) + ext
+}
+
+// removeBackups removes the rotated files beyond maxBackups or older than
+// maxAge, errors are ignored as the log can not be written about them.
+func (w *rotateWriter) removeBackups() {
+	if w.maxBackups <= 0 && w.maxAge <= 0 {
+		return
+	}
+	ext := filepath.Ext(w.path)
+	prefix := strings.TrimSuffix(w.path, ext) + "."
+	matches, err := filepath.Glob(prefix + "*" + ext)
+	if err != nil {
+		return
+	}
+	type backup struct {
+		path string
+		time time.Time
+	}
+	var backups []backup
+	for _, path := range matches {
+		t, err := time.ParseInLocation(backupTimeFormat, strings.TrimSuffix(strings.TrimPrefix(path, prefix), ext), time.Local)
+		if err != nil {
+			continue // not a rotated file
+		}
+		backups = append(backups, backup{path, t})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].time.After(backups[j].time) })
+	for inx, b := range backups {
+		if (w.maxBackups > 0 && inx >= w.maxBackups) || (w.maxAge > 0 && time.Since(b.time) > w.maxAge) {
+			_ = os.Remove(b.path)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package log
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotateWriter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "shake.log")
+	w, err := newRotateWriter(path, 10, 0, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if _, err := w.Write([]byte("12345678\n")); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond) // rotated files are named by milliseconds
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "12345678\n" {
+		t.Errorf("log file = %q, want the last line only", data)
+	}
+	backups, _ := filepath.Glob(filepath.Join(dir, "shake.*.log"))
+	if len(backups) != 2 {
+		t.Errorf("rotated files = %v, want 2 files", backups)
+	}
+	for _, backup := range backups {
+		if !strings.HasPrefix(filepath.Base(backup), "shake.20") {
+			t.Errorf("unexpected rotated file name %s", backup)
+		}
+	}
+}
+
+func TestRotateWriterInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shake.log")
+	w, err := newRotateWriter(path, 0, time.Hour, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = w.Write([]byte("first\n"))
+	if w.needRotate(1) {
+		t.Error("needRotate() = true right after open")
+	}
+	w.opened = w.opened.Add(-time.Hour)
+	if !w.needRotate(1) {
+		t.Error("needRotate() = false after the interval")
+	}
+}
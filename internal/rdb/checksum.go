@@ -0,0 +1,80 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+
+	"RedisShake/internal/config"
+	"RedisShake/internal/log"
+	"RedisShake/internal/utils"
+)
+
+// verifyChecksumBehavior verifies the RDB file before it is parsed and applies
+// rdb_checksum_behavior on failure, so that a corrupted or truncated file is not
+// partially applied to the destination.
+func (ld *Loader) verifyChecksumBehavior(version int) {
+	behavior := config.Opt.Advanced.RDBChecksumBehavior
+	switch behavior {
+	case "skip":
+		return
+	case "panic", "warn":
+	default:
+		log.Panicf("invalid rdb_checksum_behavior. rdb_checksum_behavior=[%s], should be panic, warn or skip", behavior)
+	}
+	err := verifyChecksum(ld.filPath, version)
+	if err == nil {
+		return
+	}
+	if behavior == "panic" {
+		log.Panicf("[%s] verify RDB checksum failed. file_path=[%s], error=[%v]", ld.name, ld.filPath, err)
+	}
+	log.Warnf("[%s] verify RDB checksum failed, continue to parse the file. file_path=[%s], error=[%v]", ld.name, ld.filPath, err)
+}
+
+// verifyChecksum checks that the RDB file ends with the EOF opcode and a CRC64
+// of the bytes before it. RDB files before version 5 and files saved with
+// rdbchecksum disabled have no checksum, only their end is checked.
+func verifyChecksum(filePath string, version int) error {
+	fp, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+	info, err := fp.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+	trailer := int64(1) // EOF opcode
+	if version >= 5 {
+		trailer += 8 // CRC64
+	}
+	if size < 9+trailer { // magic and version
+		return fmt.Errorf("file is truncated. size=[%d]", size)
+	}
+	buf := make([]byte, trailer)
+	if _, err = fp.ReadAt(buf, size-trailer); err != nil {
+		return err
+	}
+	if buf[0] != kEOF {
+		return fmt.Errorf("file is truncated, it does not end with the EOF opcode. size=[%d]", size)
+	}
+	if version < 5 {
+		return nil
+	}
+	expected := binary.LittleEndian.Uint64(buf[1:])
+	if expected == 0 {
+		log.Debugf("RDB checksum is disabled by the source. file_path=[%s]", filePath)
+		return nil
+	}
+	digest := utils.NewDigest()
+	if _, err = io.CopyN(digest, fp, size-8); err != nil {
+		return err
+	}
+	if actual := digest.Sum64(); actual != expected {
+		return fmt.Errorf("checksum mismatch. expected=[%016x], actual=[%016x]", expected, actual)
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"RedisShake/internal/utils"
+)
+
+func TestVerifyChecksum(t *testing.T) {
+	// select db 0, then string "k" => "v"
+	body := []byte("REDIS0011\xfe\x00\x00\x01k\x01v\xff")
+	withChecksum := binary.LittleEndian.AppendUint64(append([]byte{}, body...), utils.CalcCRC64(body))
+	corrupted := append([]byte{}, withChecksum...)
+	corrupted[13] = 'w'
+
+	tests := []struct {
+		name    string
+		data    []byte
+		version int
+		wantErr string
+	}{
+		{"valid", withChecksum, 11, ""},
+		{"checksum disabled", binary.LittleEndian.AppendUint64(append([]byte{}, body...), 0), 11, ""},
+		{"no checksum before version 5", body, 4, ""},
+		{"corrupted", corrupted, 11, "checksum mismatch"},
+		{"truncated", withChecksum[:len(withChecksum)-3], 11, "truncated"},
+		{"truncated before EOF", body[:12], 4, "truncated"},
+		{"empty", nil, 11, "truncated"},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "dump.rdb")
+		if err := os.WriteFile(path, tt.data, 0666); err != nil {
+			t.Fatal(err)
+		}
+		err := verifyChecksum(path, tt.version)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
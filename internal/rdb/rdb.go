@@ -8,9 +8,12 @@ import (
 	"io"
 	"os"
 	"strconv"
+	"sync/atomic"
 	"time"
 
+	"RedisShake/internal/config"
 	"RedisShake/internal/entry"
+	"RedisShake/internal/filter"
 	"RedisShake/internal/log"
 	"RedisShake/internal/rdb/structure"
 	"RedisShake/internal/rdb/types"
@@ -55,10 +58,11 @@ type Loader struct {
 	dumpBuffer bytes.Buffer
 
 	name       string
-	updateFunc func(int64)
+	keys       int64 // keys parsed
+	updateFunc func(offset int64, keys int64)
 }
 
-func NewLoader(name string, updateFunc func(int64), filPath string, ch chan *entry.Entry) *Loader {
+func NewLoader(name string, updateFunc func(offset int64, keys int64), filPath string, ch chan *entry.Entry) *Loader {
 	ld := new(Loader)
 	ld.ch = ch
 	ld.filPath = filPath
@@ -96,6 +100,7 @@ func (ld *Loader) ParseRDB(ctx context.Context) int {
 		log.Panicf(err.Error())
 	}
 	log.Debugf("[%s] RDB version: %d", ld.name, version)
+	ld.verifyChecksumBehavior(version)
 
 	// read entries
 	ld.parseRDBEntry(ctx, rd)
@@ -113,46 +118,50 @@ func (ld *Loader) parseRDBEntry(ctx context.Context, rd *bufio.Reader) {
 		if err != nil {
 			log.Panicf(err.Error())
 		}
-		ld.updateFunc(offset)
+		ld.updateFunc(offset, ld.keys)
 	}
 	defer updateProcessSize()
 
+	// everything is read through counter, so that its offset is the offset in
+	// the file, and the size of values is the difference of two offsets
+	counter := &countingReader{rd: rd, n: 9} // magic and version are read
+
 	// read one entry
 	ticker := time.NewTicker(time.Second * 1)
 	defer ticker.Stop()
 	for {
-		typeByte := structure.ReadByte(rd)
+		typeByte := structure.ReadByte(counter)
 		log.Debugf("RDB type byte is: [%d]", typeByte)
 		switch typeByte {
 		case kFlagModuleAux:
-			moduleId := structure.ReadLength(rd) // module id
+			moduleId := structure.ReadLength(counter) // module id
 			moduleName := types.ModuleTypeNameByID(moduleId)
 			log.Debugf("[%s] RDB module aux: module_id=[%d], module_name=[%s]", ld.name, moduleId, moduleName)
-			_ = structure.ReadLength(rd) // when_opcode
-			_ = structure.ReadLength(rd) // when
-			opcode := structure.ReadLength(rd)
+			_ = structure.ReadLength(counter) // when_opcode
+			_ = structure.ReadLength(counter) // when
+			opcode := structure.ReadLength(counter)
 			for opcode != kRDBModuleOpcodeEOF {
 				switch opcode {
 				case kRDBModuleOpcodeSINT, kRDBModuleOpcodeUINT:
-					_ = structure.ReadLength(rd)
+					_ = structure.ReadLength(counter)
 				case kRDBModuleOpcodeFLOAT:
-					_ = structure.ReadFloat(rd)
+					_ = structure.ReadFloat(counter)
 				case kRDBModuleOpcodeDOUBLE:
-					_ = structure.ReadDouble(rd)
+					_ = structure.ReadDouble(counter)
 				case kRDBModuleOpcodeSTRING:
-					_ = structure.ReadString(rd)
+					_ = structure.ReadString(counter)
 				default:
 					log.Panicf("module aux opcode not found. module_name=[%s], opcode=[%d]", moduleName, opcode)
 				}
-				opcode = structure.ReadLength(rd)
+				opcode = structure.ReadLength(counter)
 			}
 		case kFlagIdle:
-			ld.idle = int64(structure.ReadLength(rd))
+			ld.idle = int64(structure.ReadLength(counter))
 		case kFlagFreq:
-			ld.freq = int64(structure.ReadByte(rd))
+			ld.freq = int64(structure.ReadByte(counter))
 		case kFlagAUX:
-			key := structure.ReadString(rd)
-			value := structure.ReadString(rd)
+			key := structure.ReadString(counter)
+			value := structure.ReadString(counter)
 			if key == "repl-stream-db" {
 				var err error
 				ld.replStreamDbId, err = strconv.Atoi(value)
@@ -163,45 +172,56 @@ func (ld *Loader) parseRDBEntry(ctx context.Context, rd *bufio.Reader) {
 			} else if key == "lua" {
 				e := entry.NewEntry()
 				e.Argv = []string{"script", "load", value}
+				e.Phase = entry.PhaseRDB
+				e.Offset = counter.offset()
 				ld.ch <- e
 				log.Debugf("[%s] LUA script: [%s]", ld.name, value)
 			} else {
 				log.Debugf("[%s] RDB AUX: key=[%s], value=[%s]", ld.name, key, value)
 			}
 		case kFlagResizeDB:
-			dbSize := structure.ReadLength(rd)
-			expireSize := structure.ReadLength(rd)
+			dbSize := structure.ReadLength(counter)
+			expireSize := structure.ReadLength(counter)
 			log.Debugf("[%s] RDB resize db: db_size=[%d], expire_size=[%d]", ld.name, dbSize, expireSize)
 		case kFlagExpireMs:
-			ld.expireMs = int64(structure.ReadUint64(rd)) - time.Now().UnixMilli()
+			ld.expireMs = int64(structure.ReadUint64(counter)) - time.Now().UnixMilli()
 			if ld.expireMs < 0 {
 				ld.expireMs = 1
 			}
 		case kFlagExpire:
-			ld.expireMs = int64(structure.ReadUint32(rd))*1000 - time.Now().UnixMilli()
+			ld.expireMs = int64(structure.ReadUint32(counter))*1000 - time.Now().UnixMilli()
 			if ld.expireMs < 0 {
 				ld.expireMs = 1
 			}
 		case kFlagSelect:
-			ld.nowDBId = int(structure.ReadLength(rd))
+			ld.nowDBId = int(structure.ReadLength(counter))
 		case kEOF:
 			return
 		default:
-			key := structure.ReadString(rd)
-			o := types.ParseObject(rd, typeByte, key)
-			cmdC := o.Rewrite()
-			for cmd := range cmdC {
-				e := entry.NewEntry()
-				e.DbId = ld.nowDBId
-				e.Argv = cmd
-				ld.ch <- e
+			key := structure.ReadString(counter)
+			start := counter.offset()
+			o := types.ParseObject(counter, typeByte, key)
+			var size int64
+			// the size of values is needed by max_value_size and by VALUE_SIZE
+			// of functions, otherwise ValueSize of entries is not set
+			if config.Opt.Filter.MaxValueSize > 0 || filter.ReadsValueSize() {
+				// most values are read lazily by Rewrite, so the commands are
+				// kept until the whole value is read to know its size
+				var cmds rewrittenCmds
+				for cmd := range o.Rewrite() {
+					cmds = append(cmds, cmd)
+				}
+				o = cmds
+				size = counter.offset() - start
 			}
-			if ld.expireMs != 0 {
-				e := entry.NewEntry()
-				e.DbId = ld.nowDBId
-				e.Argv = []string{"PEXPIRE", key, strconv.FormatInt(ld.expireMs, 10)}
-				ld.ch <- e
+			base := &entry.Entry{
+				DbId:      ld.nowDBId,
+				ValueType: types.TypeName(typeByte),
+				ValueSize: size,
+				Phase:     entry.PhaseRDB,
 			}
+			sendRewrittenObject(ld.ch, base, key, o, ld.expireMs, counter.offset)
+			ld.keys++
 			ld.expireMs = 0
 			ld.idle = 0
 			ld.freq = 0
@@ -216,6 +236,37 @@ func (ld *Loader) parseRDBEntry(ctx context.Context, rd *bufio.Reader) {
 	}
 }
 
+// rewrittenCmds is a RedisObject whose commands are already rewritten.
+type rewrittenCmds []types.RedisCmd
+
+func (cmds rewrittenCmds) LoadFromBuffer(io.Reader, string, byte) {}
+
+func (cmds rewrittenCmds) Rewrite() <-chan types.RedisCmd {
+	ch := make(chan types.RedisCmd, len(cmds))
+	for _, cmd := range cmds {
+		ch <- cmd
+	}
+	close(ch)
+	return ch
+}
+
+// countingReader counts the bytes read. Values are read by the goroutines of
+// RedisObject.Rewrite, so the count is atomic.
+type countingReader struct {
+	rd io.Reader
+	n  int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.rd.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+	return n, err
+}
+
+func (r *countingReader) offset() int64 {
+	return atomic.LoadInt64(&r.n)
+}
+
 func (ld *Loader) createValueDump(typeByte byte, val []byte) string {
 	ld.dumpBuffer.Reset()
 	_, _ = ld.dumpBuffer.Write([]byte{typeByte})
@@ -2,8 +2,11 @@ package rdb
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"RedisShake/internal/config"
 	"RedisShake/internal/entry"
 )
 
@@ -13,7 +16,7 @@ func BenchmarkParseRDB(b *testing.B) {
 	b.ReportAllocs()
 	b.ResetTimer()
 	tempChan := make(chan *entry.Entry, 1024)
-	updateFunc := func(offset int64) {
+	updateFunc := func(offset int64, keys int64) {
 
 	}
 	b.N = 20
@@ -28,3 +31,50 @@ func BenchmarkParseRDB(b *testing.B) {
 		loader.ParseRDB(context.Background())
 	}
 }
+
+func TestParseRDBOffset(t *testing.T) {
+	config.Opt = config.ShakeOptions{Transform: config.TransformOptions{TTLMultiply: 1}}
+	config.Opt.Advanced.RDBChecksumBehavior = "skip"
+	// aux, select db 1, expire, string "k" => "v"
+	data := []byte("REDIS0011\xfa\x03ver\x017\xfe\x01\xfc\x00\x00\x00\x00\x00\x00\x00\x01\x00\x01k\x01v\xff")
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan *entry.Entry, 16)
+	NewLoader("rdb", nil, path, ch).ParseRDB(context.Background())
+	close(ch)
+	var entries []*entry.Entry
+	for e := range ch {
+		entries = append(entries, e)
+	}
+	if len(entries) == 0 {
+		t.Fatal("no entry is sent")
+	}
+	for _, e := range entries {
+		if e.DbId != 1 || e.Offset != int64(len(data)-1) {
+			t.Errorf("entry %v: db = %d, offset = %d, want db 1 and offset %d", e.Argv, e.DbId, e.Offset, len(data)-1)
+		}
+	}
+}
+
+func TestParseRDBValueSize(t *testing.T) {
+	config.Opt = config.ShakeOptions{Transform: config.TransformOptions{TTLMultiply: 1}}
+	config.Opt.Advanced.RDBChecksumBehavior = "skip"
+	config.Opt.Filter.MaxValueSize = 1024
+	// string "k" => "value", list "l" => ["a", "b"]
+	data := []byte("REDIS0011\x00\x01k\x05value\x01\x01l\x02\x01a\x01b\xff")
+	path := filepath.Join(t.TempDir(), "dump.rdb")
+	if err := os.WriteFile(path, data, 0666); err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan *entry.Entry, 16)
+	NewLoader("rdb", nil, path, ch).ParseRDB(context.Background())
+	close(ch)
+	want := map[string]int64{"k": 6, "l": 5}
+	for e := range ch {
+		if e.ValueSize != want[e.Argv[1]] {
+			t.Errorf("entry %v: value size = %d, want %d", e.Argv, e.ValueSize, want[e.Argv[1]])
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package rdb
+
+import (
+	"strconv"
+
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+	"RedisShake/internal/rdb/types"
+	"RedisShake/internal/transform"
+)
+
+// stashKeyFunc returns the name of the key used to keep an existing key aside
+// in "skip" mode. It contains the whole key, so that keys sharing a hash tag do
+// not share a stash key. It must be in the same slot as the key, so it starts
+// with the hash tag of the key, or uses the whole key as hash tag. The latter
+// does not hold for keys with braces but no valid hash tag, which only matters
+// on a cluster.
+const stashKeyFunc = `local function stash_key(key)
+  local s = string.find(key, '{', 1, true)
+  if s then
+    local e = string.find(key, '}', s + 1, true)
+    if e and e > s + 1 then return 'redis-shake:busykey:' .. string.sub(key, s, e) .. ':' .. key end
+  end
+  return 'redis-shake:busykey:{' .. key .. '}'
+end
+`
+
+const busyKeyError = "BUSYKEY Target key name already exists."
+
+const (
+	// scriptCheckBusyKey fails like RESTORE if the key exists.
+	scriptCheckBusyKey = `if redis.call('EXISTS', KEYS[1]) == 1 then return redis.error_reply('` + busyKeyError + `') end
+return 0`
+	// scriptStashBusyKey renames the key aside if it exists, so the rewritten
+	// commands create a new key instead of merging into it.
+	scriptStashBusyKey = stashKeyFunc + `if redis.call('EXISTS', KEYS[1]) == 0 then return 0 end
+redis.call('RENAME', KEYS[1], stash_key(KEYS[1]))
+return 1`
+	// scriptRestoreBusyKey puts the stashed key back over the created one and
+	// fails like RESTORE, so the key is skipped.
+	scriptRestoreBusyKey = stashKeyFunc + `local stash = stash_key(KEYS[1])
+if redis.call('EXISTS', stash) == 0 then return 0 end
+redis.call('RENAME', stash, KEYS[1])
+return redis.error_reply('` + busyKeyError + `')`
+)
+
+// SendRewrittenObject sends the commands rewritten from o to ch, followed by a
+// PEXPIRE if the key has a TTL after the TTL policy of [transform]. expireMs is
+// 0 if the key has no TTL. Every entry is a copy of base with the source TTL of
+// the key, base carries the db and the information of the value for filters.
+//
+// Unlike RESTORE, the rewritten commands merge into an existing key, so
+// rdb_restore_command_behavior is enforced with extra commands:
+//
+//	rewrite: DEL the key first.
+//	panic:   check the key first, the check replies BUSYKEY if it exists.
+//	skip:    stash the existing key first and put it back at the end, the
+//	         last command replies BUSYKEY if the key existed.
+//
+// No extra command is needed with empty_db_before_sync.
+func SendRewrittenObject(ch chan<- *entry.Entry, base *entry.Entry, key string, o types.RedisObject, expireMs int64) {
+	sendRewrittenObject(ch, base, key, o, expireMs, nil)
+}
+
+// sendRewrittenObject is SendRewrittenObject for the loader. The value is read
+// while the commands are rewritten, so offset, if not nil, returns the Offset of
+// each entry when it is sent.
+func sendRewrittenObject(ch chan<- *entry.Entry, base *entry.Entry, key string, o types.RedisObject, expireMs int64, offset func() int64) {
+	ttlMs := expireMs
+	if expireMs == 0 {
+		ttlMs = -1
+	}
+	send := func(argv ...string) {
+		e := *base
+		e.Argv = argv
+		e.TTLMs = ttlMs
+		if offset != nil {
+			e.Offset = offset()
+		}
+		ch <- &e
+	}
+	behavior := config.Opt.Advanced.RDBRestoreCommandBehavior
+	if config.Opt.Advanced.EmptyDBBeforeSync {
+		behavior = ""
+	}
+	switch behavior {
+	case "rewrite":
+		send("DEL", key)
+	case "panic":
+		send("EVAL", scriptCheckBusyKey, "1", key)
+	case "skip":
+		send("EVAL", scriptStashBusyKey, "1", key)
+	}
+	for cmd := range o.Rewrite() {
+		send(cmd...)
+	}
+	if ttl := transform.ApplyTTLPolicy(ttlMs); ttl != -1 {
+		send("PEXPIRE", key, strconv.FormatInt(ttl, 10))
+	}
+	if behavior == "skip" {
+		send("EVAL", scriptRestoreBusyKey, "1", key)
+	}
+}
@@ -0,0 +1,116 @@
+package rdb
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+func TestSendRewrittenObject(t *testing.T) {
+	o := rewrittenCmds{{"rpush", "l", "a"}, {"rpush", "l", "b"}}
+	tests := []struct {
+		behavior string
+		want     []string
+	}{
+		{"rewrite", []string{"DEL l", "rpush l a", "rpush l b", "PEXPIRE l 1000"}},
+		{"panic", []string{"EVAL <check> 1 l", "rpush l a", "rpush l b", "PEXPIRE l 1000"}},
+		{"skip", []string{"EVAL <stash> 1 l", "rpush l a", "rpush l b", "PEXPIRE l 1000", "EVAL <restore> 1 l"}},
+	}
+	scripts := strings.NewReplacer(scriptCheckBusyKey, "<check>", scriptStashBusyKey, "<stash>", scriptRestoreBusyKey, "<restore>")
+	for _, tt := range tests {
+		config.Opt = config.ShakeOptions{Transform: config.TransformOptions{TTLMultiply: 1}}
+		config.Opt.Advanced.RDBRestoreCommandBehavior = tt.behavior
+		ch := make(chan *entry.Entry, 16)
+		base := &entry.Entry{DbId: 2, ValueType: "list"}
+		SendRewrittenObject(ch, base, "l", o, 1000)
+		close(ch)
+		var got []string
+		for e := range ch {
+			if e.DbId != 2 || e.ValueType != "list" || e.TTLMs != 1000 {
+				t.Errorf("%s: entry %v does not carry base", tt.behavior, e.Argv)
+			}
+			got = append(got, scripts.Replace(strings.Join(e.Argv, " ")))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: argv = %q, want %q", tt.behavior, got, tt.want)
+		}
+	}
+
+	config.Opt.Advanced.EmptyDBBeforeSync = true
+	ch := make(chan *entry.Entry, 16)
+	SendRewrittenObject(ch, &entry.Entry{}, "l", o, 0)
+	close(ch)
+	if len(ch) != 2 {
+		t.Errorf("empty_db_before_sync: %d entries, want only the rewritten commands", len(ch))
+	}
+}
+
+// runScript runs a busy key script against the keyspace db, with EXISTS and
+// RENAME only.
+func runScript(t *testing.T, db map[string]string, script string, key string) lua.LValue {
+	L := lua.NewState()
+	defer L.Close()
+	redis := L.NewTable()
+	L.SetField(redis, "call", L.NewFunction(func(L *lua.LState) int {
+		switch cmd := L.CheckString(1); cmd {
+		case "EXISTS":
+			if _, ok := db[L.CheckString(2)]; ok {
+				L.Push(lua.LNumber(1))
+			} else {
+				L.Push(lua.LNumber(0))
+			}
+		case "RENAME":
+			from, to := L.CheckString(2), L.CheckString(3)
+			db[to] = db[from]
+			delete(db, from)
+			L.Push(lua.LString("OK"))
+		default:
+			t.Fatalf("unexpected command %s", cmd)
+		}
+		return 1
+	}))
+	L.SetField(redis, "error_reply", L.NewFunction(func(L *lua.LState) int {
+		L.Push(lua.LString("error: " + L.CheckString(1)))
+		return 1
+	}))
+	L.SetGlobal("redis", redis)
+	keys := L.NewTable()
+	keys.Append(lua.LString(key))
+	L.SetGlobal("KEYS", keys)
+	if err := L.DoString(script); err != nil {
+		t.Fatal(err)
+	}
+	return L.Get(-1)
+}
+
+func TestStashBusyKey(t *testing.T) {
+	// keys sharing a hash tag, stashed before either is put back, as when the
+	// commands of two readers interleave
+	db := map[string]string{"{user}:1": "old1", "{user}:2": "old2"}
+	runScript(t, db, scriptStashBusyKey, "{user}:1")
+	runScript(t, db, scriptStashBusyKey, "{user}:2")
+	db["{user}:1"], db["{user}:2"] = "new1", "new2"
+	if reply := runScript(t, db, scriptRestoreBusyKey, "{user}:1"); !strings.HasPrefix(reply.String(), "error: BUSYKEY") {
+		t.Errorf("restore replies %v, want BUSYKEY", reply)
+	}
+	runScript(t, db, scriptRestoreBusyKey, "{user}:2")
+	if db["{user}:1"] != "old1" || db["{user}:2"] != "old2" || len(db) != 2 {
+		t.Errorf("keyspace after restore = %v", db)
+	}
+
+	// a key not existing is created and not stashed
+	db = map[string]string{}
+	runScript(t, db, scriptStashBusyKey, "k")
+	db["k"] = "new"
+	if reply := runScript(t, db, scriptRestoreBusyKey, "k"); reply.String() != "0" {
+		t.Errorf("restore replies %v, want 0", reply)
+	}
+	if db["k"] != "new" || len(db) != 1 {
+		t.Errorf("keyspace after restore = %v", db)
+	}
+}
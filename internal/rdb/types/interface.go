@@ -17,6 +17,10 @@ const (
 	HashType = "hash"
 	// ZSetType is redis sorted set
 	ZSetType = "zset"
+	// StreamType is redis stream
+	StreamType = "stream"
+	// ModuleType is a type of redis modules
+	ModuleType = "module"
 	// AuxType is redis metadata key-value pair
 	AuxType = "aux"
 	// DBSizeType is for _OPCODE_RESIZEDB
@@ -101,6 +105,28 @@ func ParseObject(rd io.Reader, typeByte byte, key string) RedisObject {
 	return nil
 }
 
+// TypeName returns the name of the type of a value, as used by the TYPE
+// command, or "module" for the types of modules.
+func TypeName(typeByte byte) string {
+	switch typeByte {
+	case rdbTypeString:
+		return StringType
+	case rdbTypeList, rdbTypeListZiplist, rdbTypeListQuicklist, rdbTypeListQuicklist2:
+		return ListType
+	case rdbTypeSet, rdbTypeSetIntset, rdbTypeSetListpack:
+		return SetType
+	case rdbTypeZSet, rdbTypeZSet2, rdbTypeZSetZiplist, rdbTypeZSetListpack:
+		return ZSetType
+	case rdbTypeHash, rdbTypeHashZipmap, rdbTypeHashZiplist, rdbTypeHashListpack:
+		return HashType
+	case rdbTypeStreamListpacks, rdbTypeStreamListpacks2, rdbTypeStreamListpacks3:
+		return StreamType
+	case rdbTypeModule, rdbTypeModule2:
+		return ModuleType
+	}
+	return "unknown"
+}
+
 func ModuleTypeNameByID(moduleId uint64) string {
 	nameList := make([]byte, 9)
 	moduleId >>= 10
@@ -6,7 +6,7 @@ import (
 
 	"RedisShake/internal/aof"
 	"RedisShake/internal/entry"
-	"RedisShake/internal/log"
+	"RedisShake/internal/status"
 	"RedisShake/internal/utils"
 
 	"github.com/dustin/go-humanize"
@@ -38,6 +38,13 @@ func (r *aofReader) Status() interface{} {
 	return r.stat
 }
 
+func (r *aofReader) Metrics() []status.Metric {
+	return []status.Metric{
+		status.Gauge("redis_shake_reader_aof_file_size_bytes", "Size of the AOF files of the source.", float64(r.stat.AOFFileSizeBytes), "name", r.stat.AOFName),
+		status.Counter("redis_shake_reader_aof_file_sent_bytes", "Bytes of the AOF files parsed and sent to the writer.", float64(r.stat.AOFFileSentBytes), "name", r.stat.AOFName),
+	}
+}
+
 func (r *aofReader) StatusString() string {
 	return r.stat.AOFStatus
 }
@@ -47,12 +54,12 @@ func (r *aofReader) StatusConsistent() bool {
 }
 
 func NewAOFReader(opts *AOFReaderOptions) Reader {
-	log.Infof("NewAOFReader: path=[%s]", opts.Filepath)
+	logger.Infof("NewAOFReader: path=[%s]", opts.Filepath)
 	absolutePath, err := filepath.Abs(opts.Filepath)
 	if err != nil {
-		log.Panicf("NewAOFReader: filepath.Abs error: %s", err.Error())
+		logger.Panicf("NewAOFReader: filepath.Abs error: %s", err.Error())
 	}
-	log.Infof("NewAOFReader: absolute path=[%s]", absolutePath)
+	logger.Infof("NewAOFReader: absolute path=[%s]", absolutePath)
 	r := &aofReader{
 		path: absolutePath,
 		ch:   make(chan *entry.Entry),
@@ -77,25 +84,25 @@ func (r *aofReader) StartRead(ctx context.Context) []chan *entry.Entry {
 		aofFileInfo.AOFLoadManifestFromDisk()
 		manifestInfo := aofFileInfo.AOFManifest
 		if manifestInfo == nil { // load single aof file
-			log.Infof("start send single AOF path=[%s]", r.path)
+			logger.Infof("start send single AOF path=[%s]", r.path)
 			aofLoader := aof.NewLoader(r.path, r.ch)
 			ret := aofLoader.LoadSingleAppendOnlyFile(ctx, r.stat.AOFTimestamp)
 			if ret == AOFOk || ret == AOFTruncated {
-				log.Infof("The AOF File was successfully loaded")
+				logger.Infof("The AOF File was successfully loaded")
 			} else {
-				log.Infof("There was an error opening the AOF File.")
+				logger.Infof("There was an error opening the AOF File.")
 			}
-			log.Infof("Send single AOF finished. path=[%s]", r.path)
+			logger.Infof("Send single AOF finished. path=[%s]", r.path)
 			close(r.ch)
 		} else {
 			aofLoader := NewAOFFileInfo(r.path, r.ch)
 			ret := aofLoader.LoadAppendOnlyFile(ctx, manifestInfo, r.stat.AOFTimestamp)
 			if ret == AOFOk || ret == AOFTruncated {
-				log.Infof("The AOF File was successfully loaded")
+				logger.Infof("The AOF File was successfully loaded")
 			} else {
-				log.Infof("There was an error opening the AOF File.")
+				logger.Infof("There was an error opening the AOF File.")
 			}
-			log.Infof("Send multi-part AOF finished. path=[%s]", r.path)
+			logger.Infof("Send multi-part AOF finished. path=[%s]", r.path)
 			close(r.ch)
 		}
 
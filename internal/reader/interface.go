@@ -2,10 +2,13 @@ package reader
 
 import (
 	"RedisShake/internal/entry"
+	"RedisShake/internal/log"
 	"RedisShake/internal/status"
 	"context"
 )
 
+var logger = log.Component("reader")
+
 type Reader interface {
 	status.Statusable
 	StartRead(ctx context.Context) []chan *entry.Entry
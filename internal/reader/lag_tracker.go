@@ -0,0 +1,50 @@
+package reader
+
+import (
+	"sync"
+	"time"
+)
+
+// lagTracker estimates the replication lag in seconds. The source streams its
+// writes to replicas as they happen, so the time an offset is received is close
+// to the time the source wrote it. The lag is the age of the first byte that
+// is received but not sent to the writer yet.
+type lagTracker struct {
+	mux     sync.Mutex
+	samples []offsetSample // in the order of offset
+}
+
+type offsetSample struct {
+	offset int64 // the bytes up to offset are received at time
+	time   time.Time
+}
+
+// sampleInterval bounds the number of samples, the lag is overestimated by at
+// most this interval.
+const sampleInterval = 10 * time.Millisecond
+
+// received records that the bytes up to offset are received at now.
+func (t *lagTracker) received(offset int64, now time.Time) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	if n := len(t.samples); n > 0 && now.Sub(t.samples[n-1].time) < sampleInterval {
+		t.samples[n-1].offset = offset
+		return
+	}
+	t.samples = append(t.samples, offsetSample{offset: offset, time: now})
+}
+
+// lag returns the lag in seconds when the bytes up to sentOffset are sent.
+func (t *lagTracker) lag(sentOffset int64, now time.Time) float64 {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	inx := 0
+	for inx < len(t.samples) && t.samples[inx].offset <= sentOffset {
+		inx++
+	}
+	t.samples = t.samples[inx:]
+	if len(t.samples) == 0 {
+		return 0
+	}
+	return now.Sub(t.samples[0].time).Seconds()
+}
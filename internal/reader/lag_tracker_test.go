@@ -0,0 +1,36 @@
+package reader
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLagTracker(t *testing.T) {
+	var tracker lagTracker
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	if lag := tracker.lag(0, at(0)); lag != 0 {
+		t.Errorf("lag without data = %v, want 0", lag)
+	}
+	tracker.received(100, at(0))
+	tracker.received(150, at(5)) // merged into the previous sample
+	tracker.received(200, at(1000))
+	tracker.received(300, at(2000))
+	cases := []struct {
+		sent int64
+		now  int
+		want float64
+	}{
+		{0, 3000, 3},
+		{149, 3000, 3},
+		{150, 3000, 2},
+		{250, 3500, 1.5},
+		{300, 4000, 0},
+	}
+	for _, c := range cases {
+		if lag := tracker.lag(c.sent, at(c.now)); lag != c.want {
+			t.Errorf("lag(%d) at %dms = %v, want %v", c.sent, c.now, lag, c.want)
+		}
+	}
+}
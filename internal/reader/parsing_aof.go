@@ -17,7 +17,6 @@ import (
 
 	"RedisShake/internal/aof"
 	"RedisShake/internal/entry"
-	"RedisShake/internal/log"
 )
 
 const (
@@ -326,7 +325,7 @@ func AOFLoadManifestFromFile(amFilepath string) *AOFManifest {
 	am := AOFManifestCreate()
 	fp, err := os.Open(amFilepath)
 	if err != nil {
-		log.Panicf("Fatal error:can't open the AOF manifest %v for reading: %v", amFilepath, err)
+		logger.Panicf("Fatal error:can't open the AOF manifest %v for reading: %v", amFilepath, err)
 	}
 	defer fp.Close()
 	var argv []string
@@ -339,7 +338,7 @@ func AOFLoadManifestFromFile(amFilepath string) *AOFManifest {
 		if err != nil {
 			if err == io.EOF {
 				if lineNum == 0 {
-					log.Infof("Found an empty AOF manifest")
+					logger.Infof("Found an empty AOF manifest")
 					am = nil
 					return am
 				} else {
@@ -347,8 +346,8 @@ func AOFLoadManifestFromFile(amFilepath string) *AOFManifest {
 				}
 
 			} else {
-				log.Infof("Reading the manifest file, at line %d", lineNum)
-				log.Infof("Read AOF manifest failed")
+				logger.Infof("Reading the manifest file, at line %d", lineNum)
+				logger.Infof("Read AOF manifest failed")
 				am = nil
 				return am
 
@@ -360,22 +359,22 @@ func AOFLoadManifestFromFile(amFilepath string) *AOFManifest {
 			continue
 		}
 		if !strings.Contains(buf, "\n") {
-			log.Infof("Reading the manifest file, at line %d", lineNum)
-			log.Infof("The AOF manifest File contains too long line")
+			logger.Infof("Reading the manifest file, at line %d", lineNum)
+			logger.Infof("The AOF manifest File contains too long line")
 			return nil
 		}
 		line = strings.Trim(buf, " \t\r\n")
 		if len(line) == 0 {
-			log.Infof("Reading the manifest file, at line %d", lineNum)
-			log.Infof("Invalid AOF manifest File format")
+			logger.Infof("Reading the manifest file, at line %d", lineNum)
+			logger.Infof("Invalid AOF manifest File format")
 			return nil
 		}
 		argc := 0
 		argv, argc = SplitArgs(line)
 
 		if argc < 6 || argc%2 != 0 {
-			log.Infof("Reading the manifest file, at line %d", lineNum)
-			log.Infof("Invalid AOF manifest File format")
+			logger.Infof("Reading the manifest file, at line %d", lineNum)
+			logger.Infof("Invalid AOF manifest File format")
 			am = nil
 			return am
 		}
@@ -384,8 +383,8 @@ func AOFLoadManifestFromFile(amFilepath string) *AOFManifest {
 			if strings.EqualFold(argv[i], AOFManifestKeyFileName) {
 				ai.FileName = argv[i+1]
 				if !PathIsBaseName(ai.FileName) {
-					log.Infof("Reading the manifest file, at line %d", lineNum)
-					log.Panicf("File can't be a path, just a Filename")
+					logger.Infof("Reading the manifest file, at line %d", lineNum)
+					logger.Panicf("File can't be a path, just a Filename")
 				}
 			} else if strings.EqualFold(argv[i], AOFManifestKeyFileSeq) {
 				ai.FileSeq, _ = strconv.ParseInt(argv[i+1], 10, 64)
@@ -394,13 +393,13 @@ func AOFLoadManifestFromFile(amFilepath string) *AOFManifest {
 			}
 		}
 		if ai.FileName == "" || ai.FileSeq == 0 || ai.AOFFileType == "" {
-			log.Infof("Reading the manifest file, at line %d", lineNum)
-			log.Panicf("Invalid AOF manifest File format")
+			logger.Infof("Reading the manifest file, at line %d", lineNum)
+			logger.Panicf("Invalid AOF manifest File format")
 		}
 		if ai.AOFFileType == AOFManifestFileTypeBase {
 			if am.BaseAOFInfo != nil {
-				log.Infof("Reading the manifest file, at line %d", lineNum)
-				log.Panicf("Found duplicate Base File information")
+				logger.Infof("Reading the manifest file, at line %d", lineNum)
+				logger.Panicf("Found duplicate Base File information")
 			}
 			am.BaseAOFInfo = ai
 			am.CurrBaseFileSeq = ai.FileSeq
@@ -408,15 +407,15 @@ func AOFLoadManifestFromFile(amFilepath string) *AOFManifest {
 			am.HistoryList.PushBack(ai)
 		} else if ai.AOFFileType == AOFManifestTypeIncr {
 			if ai.FileSeq <= maxSeq {
-				log.Infof("Reading the manifest file, at line %d", lineNum)
-				log.Panicf("Found a non-monotonic sequence number")
+				logger.Infof("Reading the manifest file, at line %d", lineNum)
+				logger.Panicf("Found a non-monotonic sequence number")
 			}
 			am.incrAOFList.PushBack(ai)
 			am.CurrIncrFileSeq = ai.FileSeq
 			maxSeq = ai.FileSeq
 		} else {
-			log.Infof("Reading the manifest file, at line %d", lineNum)
-			log.Panicf("Unknown AOF File type")
+			logger.Infof("Reading the manifest file, at line %d", lineNum)
+			logger.Panicf("Unknown AOF File type")
 		}
 		ai = nil
 	}
@@ -460,13 +459,13 @@ func GetAOFManifestAsString(am *AOFManifest) string {
 
 func (aofInfo *INFO) AOFLoadManifestFromDisk() {
 	if DirExists(aofInfo.AOFDirName) == 0 {
-		log.Infof("The AOF Directory %v doesn't exist", aofInfo.AOFDirName)
+		logger.Infof("The AOF Directory %v doesn't exist", aofInfo.AOFDirName)
 		return
 	}
 	aofInfo.AOFManifest = AOFManifestCreate()
 	amFilepath := path.Join(aofInfo.AOFDirName, aofInfo.AOFFileName)
 	if FileExist(amFilepath) == 0 {
-		log.Infof("The AOF Directory %v doesn't exist", aofInfo.AOFDirName)
+		logger.Infof("The AOF Directory %v doesn't exist", aofInfo.AOFDirName)
 		return
 	}
 
@@ -498,7 +497,7 @@ func (aofInfo *INFO) GetAppendOnlyFileSize(FileName string, status *int) int64 {
 				*status = AOFOpenErr
 			}
 		}
-		log.Panicf("Unable to obtain the AOF File %v length. stat: %v", FileName, err.Error())
+		logger.Panicf("Unable to obtain the AOF File %v length. stat: %v", FileName, err.Error())
 		size = 0
 	} else {
 		if status != nil {
@@ -513,7 +512,7 @@ func (aofInfo *INFO) GetBaseAndIncrAppendOnlyFilesSize(am *AOFManifest, status *
 	var size int64
 	if am.BaseAOFInfo != nil {
 		if am.BaseAOFInfo.AOFFileType != AOFManifestFileTypeBase {
-			log.Panicf("File type must be Base.")
+			logger.Panicf("File type must be Base.")
 		}
 		size += aofInfo.GetAppendOnlyFileSize(am.BaseAOFInfo.FileName, status)
 		if *status != AOFOk {
@@ -524,7 +523,7 @@ func (aofInfo *INFO) GetBaseAndIncrAppendOnlyFilesSize(am *AOFManifest, status *
 	for ln := am.HistoryList.Front(); ln != nil; ln = ln.Next() {
 		ai := ln.Value.(*AOFInfo)
 		if ai.AOFFileType != AOFManifestTypeIncr {
-			log.Panicf("File type must be Incr")
+			logger.Panicf("File type must be Incr")
 		}
 		size += aofInfo.GetAppendOnlyFileSize(ai.FileName, status)
 		if *status != AOFOk {
@@ -558,7 +557,7 @@ func GetHistoryAndIncrAppendOnlyFilesNum(am *AOFManifest) int {
 
 func (aofInfo *INFO) LoadAppendOnlyFile(ctx context.Context, am *AOFManifest, AOFTimeStamp int64) int {
 	if am == nil {
-		log.Panicf("AOFManifest is null")
+		logger.Panicf("AOFManifest is null")
 	}
 	status := AOFOk
 	ret := AOFOk
@@ -574,7 +573,7 @@ func (aofInfo *INFO) LoadAppendOnlyFile(ctx context.Context, am *AOFManifest, AO
 
 	totalNum = GetBaseAndIncrAppendOnlyFilesNum(am)
 	if totalNum <= 0 {
-		log.Panicf("Assertion failed: IncrAppendOnlyFilestotalNum > 0")
+		logger.Panicf("Assertion failed: IncrAppendOnlyFilestotalNum > 0")
 	}
 
 	totalSize = aofInfo.GetBaseAndIncrAppendOnlyFilesSize(am, &status)
@@ -587,7 +586,7 @@ func (aofInfo *INFO) LoadAppendOnlyFile(ctx context.Context, am *AOFManifest, AO
 		return AOFEmpty
 	}
 
-	log.Infof("The AOF File starts loading.")
+	logger.Infof("The AOF File starts loading.")
 	if am.BaseAOFInfo != nil {
 		if am.BaseAOFInfo.AOFFileType == AOFManifestFileTypeBase {
 			AOFName = am.BaseAOFInfo.FileName
@@ -596,19 +595,19 @@ func (aofInfo *INFO) LoadAppendOnlyFile(ctx context.Context, am *AOFManifest, AO
 			start = Ustime()
 			ret = aofInfo.ParsingSingleAppendOnlyFile(ctx, AOFName, 0) //Currently, RDB files cannot be restored at a point in time.
 			if ret == AOFOk || (ret == AOFTruncated) {
-				log.Infof("DB loaded from Base File %v: %.3f seconds", AOFName, float64(Ustime()-start)/1000000)
+				logger.Infof("DB loaded from Base File %v: %.3f seconds", AOFName, float64(Ustime()-start)/1000000)
 			}
 			if ret == AOFEmpty {
 				ret = AOFOk
 			}
 			if ret == AOFOk || ret == AOFTruncated {
-				log.Infof("The AOF File was successfully loaded")
+				logger.Infof("The AOF File was successfully loaded")
 			}
 			if ret == AOFOpenErr || ret == AOFFailed {
 				if ret == AOFOpenErr {
-					log.Panicf("There was an error opening the AOF File.")
+					logger.Panicf("There was an error opening the AOF File.")
 				} else {
-					log.Panicf("Failed to open AOF File.")
+					logger.Panicf("Failed to open AOF File.")
 				}
 				return ret
 			}
@@ -616,12 +615,12 @@ func (aofInfo *INFO) LoadAppendOnlyFile(ctx context.Context, am *AOFManifest, AO
 		totalNum--
 	} else {
 		totalNum = GetHistoryAndIncrAppendOnlyFilesNum(am)
-		log.Infof("The BaseAOF file does not exist. Start loading the HistoryAOF and IncrAOF files.")
+		logger.Infof("The BaseAOF file does not exist. Start loading the HistoryAOF and IncrAOF files.")
 		if am.HistoryList.Len() > 0 {
 			for ln := am.HistoryList.Front(); ln != nil; ln = ln.Next() {
 				ai := ln.Value.(*AOFInfo)
 				if ai.AOFFileType != AOFManifestTypeHist {
-					log.Panicf("The manifestType must be Hist")
+					logger.Panicf("The manifestType must be Hist")
 				}
 				AOFName = ai.FileName
 				aofInfo.UpdateLoadingFileName(AOFName)
@@ -629,7 +628,7 @@ func (aofInfo *INFO) LoadAppendOnlyFile(ctx context.Context, am *AOFManifest, AO
 				start = Ustime()
 				ret = aofInfo.ParsingSingleAppendOnlyFile(ctx, AOFName, AOFTimeStamp)
 				if ret == AOFOk || (ret == AOFTruncated) {
-					log.Infof("DB loaded from History File %v: %.3f seconds", AOFName, float64(Ustime()-start)/1000000)
+					logger.Infof("DB loaded from History File %v: %.3f seconds", AOFName, float64(Ustime()-start)/1000000)
 					return ret
 				}
 				if ret == AOFEmpty {
@@ -637,9 +636,9 @@ func (aofInfo *INFO) LoadAppendOnlyFile(ctx context.Context, am *AOFManifest, AO
 				}
 				if ret == AOFOpenErr || ret == AOFFailed {
 					if ret == AOFOpenErr {
-						log.Panicf("There was an error opening the AOF File.")
+						logger.Panicf("There was an error opening the AOF File.")
 					} else {
-						log.Infof("Failed to open AOF File.")
+						logger.Infof("Failed to open AOF File.")
 					}
 					return ret
 				}
@@ -653,7 +652,7 @@ func (aofInfo *INFO) LoadAppendOnlyFile(ctx context.Context, am *AOFManifest, AO
 		for ln := am.incrAOFList.Front(); ln != nil; ln = ln.Next() {
 			ai := ln.Value.(*AOFInfo)
 			if ai.AOFFileType != AOFManifestTypeIncr {
-				log.Panicf("The manifestType must be Incr")
+				logger.Panicf("The manifestType must be Incr")
 			}
 			AOFName = ai.FileName
 			aofInfo.UpdateLoadingFileName(AOFName)
@@ -661,7 +660,7 @@ func (aofInfo *INFO) LoadAppendOnlyFile(ctx context.Context, am *AOFManifest, AO
 			start = Ustime()
 			ret = aofInfo.ParsingSingleAppendOnlyFile(ctx, AOFName, AOFTimeStamp)
 			if ret == AOFOk || (ret == AOFTruncated) {
-				log.Infof("DB loaded from incr File %v: %.3f seconds", AOFName, float64(Ustime()-start)/1000000)
+				logger.Infof("DB loaded from incr File %v: %.3f seconds", AOFName, float64(Ustime()-start)/1000000)
 				return ret
 			}
 			if ret == AOFEmpty {
@@ -669,9 +668,9 @@ func (aofInfo *INFO) LoadAppendOnlyFile(ctx context.Context, am *AOFManifest, AO
 			}
 			if ret == AOFOpenErr || ret == AOFFailed {
 				if ret == AOFOpenErr {
-					log.Panicf("There was an error opening the AOF File.")
+					logger.Panicf("There was an error opening the AOF File.")
 				} else {
-					log.Infof("Failed to open AOF File.")
+					logger.Infof("Failed to open AOF File.")
 				}
 				return ret
 			}
@@ -679,14 +678,14 @@ func (aofInfo *INFO) LoadAppendOnlyFile(ctx context.Context, am *AOFManifest, AO
 		}
 	}
 	if totalNum == 0 {
-		log.Infof("All AOF files have been sent.")
+		logger.Infof("All AOF files have been sent.")
 	} else {
-		log.Panicf("There are still %d AOF files that were not successfully sent.", totalNum)
+		logger.Panicf("There are still %d AOF files that were not successfully sent.", totalNum)
 	}
 	aofInfo.AOFCurrentSize = totalSize
 	aofInfo.AOFRewriteBaseSize = BaseSize
 
-	log.Infof("The AOF File loading end.")
+	logger.Infof("The AOF File loading end.")
 	return ret
 
 }
@@ -698,10 +697,10 @@ func (aofInfo *INFO) ParsingSingleAppendOnlyFile(ctx context.Context, FileName s
 	if err != nil {
 		if os.IsNotExist(err) {
 			if _, err := os.Stat(AOFFilepath); err == nil || !os.IsNotExist(err) {
-				log.Infof("Fatal error: can't open the append log File %v for reading: %v", FileName, err.Error())
+				logger.Infof("Fatal error: can't open the append log File %v for reading: %v", FileName, err.Error())
 				return AOFOpenErr
 			} else {
-				log.Infof("The append log File %v doesn't exist: %v", FileName, err.Error())
+				logger.Infof("The append log File %v doesn't exist: %v", FileName, err.Error())
 				return AOFNotExist
 			}
 
@@ -716,11 +715,11 @@ func (aofInfo *INFO) ParsingSingleAppendOnlyFile(ctx context.Context, FileName s
 	sig := make([]byte, 5)
 	if n, err := fp.Read(sig); err != nil || n != 5 || !bytes.Equal(sig, []byte("REDIS")) {
 		if _, err := fp.Seek(0, 0); err != nil {
-			log.Infof("Unrecoverable error reading the append only File %v: %v", FileName, err)
+			logger.Infof("Unrecoverable error reading the append only File %v: %v", FileName, err)
 			return AOFFailed
 		}
 	} else { //Skipped RDB checksum and has not been processed yet.
-		log.Infof("Reading RDB Base File on AOF loading...")
+		logger.Infof("Reading RDB Base File on AOF loading...")
 		rdbOpt := RdbReaderOptions{Filepath: AOFFilepath}
 		ldRDB := NewRDBReader(&rdbOpt)
 		ldRDB.StartRead(ctx)
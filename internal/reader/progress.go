@@ -0,0 +1,73 @@
+package reader
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// progressMeter measures the throughput of the snapshot phase and estimates
+// when it finishes. The rates are exponential moving averages over about
+// progressWindow, so the ETA follows the recent throughput instead of the
+// average since the start.
+type progressMeter struct {
+	sampled time.Time
+	keys    int64
+	bytes   int64
+	done    float64 // in the unit of the total passed to stat
+	rated   bool
+
+	keysPerSec  float64
+	bytesPerSec float64
+	donePerSec  float64
+}
+
+const progressWindow = 30 * time.Second
+
+// update records that keys and bytes are processed and the phase is done up to
+// done at now. Samples less than a second apart are skipped.
+func (m *progressMeter) update(keys int64, bytes int64, done float64, now time.Time) {
+	if m.sampled.IsZero() {
+		m.sampled, m.keys, m.bytes, m.done = now, keys, bytes, done
+		return
+	}
+	elapsed := now.Sub(m.sampled)
+	if elapsed < time.Second {
+		return
+	}
+	sec := elapsed.Seconds()
+	alpha := 1 - math.Exp(-sec/progressWindow.Seconds())
+	if !m.rated {
+		alpha = 1 // the first rate is taken as is
+		m.rated = true
+	}
+	m.keysPerSec += alpha * (float64(keys-m.keys)/sec - m.keysPerSec)
+	m.bytesPerSec += alpha * (float64(bytes-m.bytes)/sec - m.bytesPerSec)
+	m.donePerSec += alpha * ((done-m.done)/sec - m.donePerSec)
+	m.sampled, m.keys, m.bytes, m.done = now, keys, bytes, done
+}
+
+// stat returns the throughput and the seconds left to reach total, which is
+// -1 when it can not be estimated yet.
+func (m *progressMeter) stat(total float64) (keysPerSec float64, bytesPerSec float64, etaSec float64) {
+	switch {
+	case m.done >= total:
+		etaSec = 0
+	case m.donePerSec <= 0:
+		etaSec = -1
+	default:
+		etaSec = (total - m.done) / m.donePerSec
+	}
+	return m.keysPerSec, m.bytesPerSec, etaSec
+}
+
+// formatProgress formats the throughput and the ETA for the periodic log.
+func formatProgress(keysPerSec float64, bytesPerSec float64, etaSec float64) string {
+	eta := "unknown"
+	if etaSec >= 0 {
+		eta = (time.Duration(etaSec) * time.Second).String()
+	}
+	return fmt.Sprintf("speed=[%.0f keys/s, %s/s], eta=[%s]", keysPerSec, humanize.IBytes(uint64(bytesPerSec)), eta)
+}
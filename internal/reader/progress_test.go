@@ -0,0 +1,33 @@
+package reader
+
+import (
+	"testing"
+	"time"
+)
+
+func TestProgressMeter(t *testing.T) {
+	var m progressMeter
+	start := time.Now()
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+
+	if _, _, eta := m.stat(1000); eta != -1 {
+		t.Errorf("eta without samples = %v, want -1", eta)
+	}
+	m.update(0, 0, 0, at(0))
+	m.update(10, 100, 100, at(500)) // skipped, less than a second apart
+	m.update(20, 200, 200, at(2000))
+	keysPerSec, bytesPerSec, eta := m.stat(1000)
+	if keysPerSec != 10 || bytesPerSec != 100 || eta != 8 {
+		t.Errorf("stat() = %v, %v, %v, want 10, 100, 8", keysPerSec, bytesPerSec, eta)
+	}
+
+	// the rate moves towards the recent throughput
+	m.update(20, 200, 200, at(32000))
+	if keysPerSec, _, _ := m.stat(1000); keysPerSec <= 0 || keysPerSec >= 10 {
+		t.Errorf("keysPerSec after a stall = %v, want between 0 and 10", keysPerSec)
+	}
+	m.update(30, 1000, 1000, at(33000))
+	if _, _, eta := m.stat(1000); eta != 0 {
+		t.Errorf("eta when done = %v, want 0", eta)
+	}
+}
@@ -3,10 +3,12 @@ package reader
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"RedisShake/internal/entry"
-	"RedisShake/internal/log"
+	"RedisShake/internal/hook"
 	"RedisShake/internal/rdb"
+	"RedisShake/internal/status"
 	"RedisShake/internal/utils"
 
 	"github.com/dustin/go-humanize"
@@ -17,17 +19,22 @@ type RdbReaderOptions struct {
 }
 
 type rdbReader struct {
-	ch chan *entry.Entry
+	ch       chan *entry.Entry
+	progress progressMeter
 
 	stat struct {
-		Name          string `json:"name"`
-		Status        string `json:"status"`
-		Filepath      string `json:"filepath"`
-		FileSizeBytes int64  `json:"file_size_bytes"`
-		FileSizeHuman string `json:"file_size_human"`
-		FileSentBytes int64  `json:"file_sent_bytes"`
-		FileSentHuman string `json:"file_sent_human"`
-		Percent       string `json:"percent"`
+		Name          string  `json:"name"`
+		Status        string  `json:"status"`
+		Filepath      string  `json:"filepath"`
+		FileSizeBytes int64   `json:"file_size_bytes"`
+		FileSizeHuman string  `json:"file_size_human"`
+		FileSentBytes int64   `json:"file_sent_bytes"`
+		FileSentHuman string  `json:"file_sent_human"`
+		FileSentKeys  int64   `json:"file_sent_keys"`
+		Percent       string  `json:"percent"`
+		KeysPerSec    float64 `json:"keys_per_sec"`
+		BytesPerSec   float64 `json:"bytes_per_sec"`
+		EtaSec        float64 `json:"eta_sec"` // estimated seconds to send the rest of the file, -1 means unknown
 	}
 }
 
@@ -39,23 +46,31 @@ func NewRDBReader(opts *RdbReaderOptions) Reader {
 	r.stat.Filepath = absolutePath
 	r.stat.FileSizeBytes = int64(utils.GetFileSize(absolutePath))
 	r.stat.FileSizeHuman = humanize.Bytes(uint64(r.stat.FileSizeBytes))
+	r.stat.EtaSec = -1
 	return r
 }
 
 func (r *rdbReader) StartRead(ctx context.Context) []chan *entry.Entry {
-	log.Infof("[%s] start read", r.stat.Name)
+	logger.Infof("[%s] start read", r.stat.Name)
 	r.ch = make(chan *entry.Entry, 1024)
-	updateFunc := func(offset int64) {
+	updateFunc := func(offset int64, keys int64) {
 		r.stat.FileSentBytes = offset
 		r.stat.FileSentHuman = humanize.Bytes(uint64(offset))
+		r.stat.FileSentKeys = keys
 		r.stat.Percent = fmt.Sprintf("%.2f%%", float64(offset)/float64(r.stat.FileSizeBytes)*100)
-		r.stat.Status = fmt.Sprintf("[%s] rdb file synced: %s", r.stat.Name, r.stat.Percent)
+		r.progress.update(keys, offset, float64(offset), time.Now())
+		r.stat.KeysPerSec, r.stat.BytesPerSec, r.stat.EtaSec = r.progress.stat(float64(r.stat.FileSizeBytes))
+		r.stat.Status = fmt.Sprintf("[%s] rdb file synced: %s, keys=[%d], %s", r.stat.Name, r.stat.Percent,
+			keys, formatProgress(r.stat.KeysPerSec, r.stat.BytesPerSec, r.stat.EtaSec))
 	}
 	rdbLoader := rdb.NewLoader(r.stat.Name, updateFunc, r.stat.Filepath, r.ch)
 
 	go func() {
 		_ = rdbLoader.ParseRDB(ctx)
-		log.Infof("[%s] rdb file parse done", r.stat.Name)
+		logger.Infof("[%s] rdb file parse done", r.stat.Name)
+		if ctx.Err() == nil { // not stopped halfway
+			hook.Trigger(hook.RdbApplied, r.stat.Name, "keys=[%d]", r.stat.FileSentKeys)
+		}
 		close(r.ch)
 	}()
 
@@ -66,6 +81,15 @@ func (r *rdbReader) Status() interface{} {
 	return r.stat
 }
 
+func (r *rdbReader) Metrics() []status.Metric {
+	return []status.Metric{
+		status.Gauge("redis_shake_reader_rdb_size_bytes", "Size of the RDB of the source.", float64(r.stat.FileSizeBytes), "name", r.stat.Name),
+		status.Counter("redis_shake_reader_rdb_sent_bytes", "Bytes of the RDB parsed and sent to the writer.", float64(r.stat.FileSentBytes), "name", r.stat.Name),
+		status.Counter("redis_shake_reader_rdb_sent_keys", "Keys of the RDB parsed and sent to the writer.", float64(r.stat.FileSentKeys), "name", r.stat.Name),
+		status.Gauge("redis_shake_reader_rdb_eta_seconds", "Estimated seconds to send the rest of the RDB, -1 means unknown.", r.stat.EtaSec, "name", r.stat.Name),
+	}
+}
+
 func (r *rdbReader) StatusString() string {
 	return r.stat.Status
 }
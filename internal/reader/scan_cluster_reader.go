@@ -5,6 +5,7 @@ import (
 	"fmt"
 
 	"RedisShake/internal/entry"
+	"RedisShake/internal/status"
 	"RedisShake/internal/utils"
 )
 
@@ -42,6 +43,10 @@ func (rd *scanClusterReader) Status() interface{} {
 	return stat
 }
 
+func (rd *scanClusterReader) Metrics() []status.Metric {
+	return status.CollectMetrics(rd.readers)
+}
+
 func (rd *scanClusterReader) StatusString() string {
 	rd.statusId += 1
 	rd.statusId %= len(rd.readers)
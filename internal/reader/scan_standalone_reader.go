@@ -8,13 +8,17 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"RedisShake/internal/client"
 	"RedisShake/internal/client/proto"
 	"RedisShake/internal/config"
 	"RedisShake/internal/entry"
-	"RedisShake/internal/log"
+	"RedisShake/internal/rdb"
 	"RedisShake/internal/rdb/types"
+	"RedisShake/internal/status"
+	"RedisShake/internal/transform"
 	"RedisShake/internal/utils"
 )
 
@@ -49,14 +53,20 @@ type scanStandaloneReader struct {
 	needDumpQueue   *utils.UniqueQueue
 	needRestoreChan chan *needRestoreItem
 	dumpClient      *client.Redis
+	progress        progressMeter
 
 	stat struct {
-		Name              string `json:"name"`
-		ScanFinished      bool   `json:"scan_finished"`
-		ScanDbId          int    `json:"scan_dbId"`
-		ScanCursor        uint64 `json:"scan_cursor"`
-		ScanPercentByDbId string `json:"scan_percent"`
-		NeedUpdateCount   int64  `json:"need_update_count"`
+		Name              string  `json:"name"`
+		ScanFinished      bool    `json:"scan_finished"`
+		ScanDbId          int     `json:"scan_dbId"`
+		ScanCursor        uint64  `json:"scan_cursor"`
+		ScanPercentByDbId string  `json:"scan_percent"`
+		NeedUpdateCount   int64   `json:"need_update_count"`
+		SentKeys          int64   `json:"sent_keys"`  // keys dumped and sent to chan
+		SentBytes         int64   `json:"sent_bytes"` // bytes of the dumped values
+		KeysPerSec        float64 `json:"keys_per_sec"`
+		BytesPerSec       float64 `json:"bytes_per_sec"`
+		ScanEtaSec        float64 `json:"scan_eta_sec"` // estimated seconds to scan all dbs, -1 means unknown
 	}
 }
 
@@ -72,7 +82,7 @@ func NewScanStandaloneReader(ctx context.Context, opts *ScanReaderOptions) Reade
 		c.Send("info", "keyspace")
 		info, err := c.Receive()
 		if err != nil {
-			log.Panicf(err.Error())
+			logger.Panicf(err.Error())
 		}
 		r.dbs = utils.ParseDBs(info.(string))
 	}
@@ -81,7 +91,8 @@ func NewScanStandaloneReader(ctx context.Context, opts *ScanReaderOptions) Reade
 	r.stat.Name = "reader_" + strings.Replace(opts.Address, ":", "_", -1)
 	r.needDumpQueue = utils.NewUniqueQueue(100000)        // cache 100000 keys
 	r.needRestoreChan = make(chan *needRestoreItem, 1024) // inflight 1024 keys
-	log.Infof("[%s] scanStandaloneReader init finished. dbs=[%v]", r.stat.Name, r.dbs)
+	r.stat.ScanEtaSec = -1
+	logger.Infof("[%s] scanStandaloneReader init finished. dbs=[%v]", r.stat.Name, r.dbs)
 	return r
 }
 
@@ -112,26 +123,26 @@ func (r *scanStandaloneReader) subscript() {
 	}
 	_, err := c.Receive()
 	if err != nil {
-		log.Panicf(err.Error())
+		logger.Panicf(err.Error())
 	}
 	regex := regexp.MustCompile(`\d+`)
 	for {
 		select {
 		case <-r.ctx.Done():
-			log.Infof("[%s] scanStandaloneReader subscript finished.", r.stat.Name)
+			logger.Infof("[%s] scanStandaloneReader subscript finished.", r.stat.Name)
 			r.needDumpQueue.Close()
 			return
 		default:
 			resp, err := c.Receive()
 			if err != nil {
-				log.Panicf(err.Error())
+				logger.Panicf(err.Error())
 			}
 			respSlice := resp.([]interface{})
 			key := respSlice[3].(string)
 			dbId := regex.FindString(respSlice[2].(string))
 			dbIdInt, err := strconv.Atoi(dbId)
 			if err != nil {
-				log.Panicf(err.Error())
+				logger.Panicf(err.Error())
 			}
 			// handle del action
 			eventSlice := strings.Split(respSlice[2].(string), ":")
@@ -139,6 +150,7 @@ func (r *scanStandaloneReader) subscript() {
 				e := entry.NewEntry()
 				e.DbId = dbIdInt
 				e.Argv = []string{"DEL", key}
+				e.Phase = entry.PhaseAOF
 				r.ch <- e
 				continue
 			}
@@ -150,11 +162,11 @@ func (r *scanStandaloneReader) subscript() {
 func (r *scanStandaloneReader) scan() {
 	c := client.NewRedisClient(r.ctx, r.opts.Address, r.opts.Username, r.opts.Password, r.opts.Tls, r.opts.PreferReplica)
 	defer c.Close()
-	for _, dbId := range r.dbs {
+	for dbInx, dbId := range r.dbs {
 		if dbId != 0 {
 			reply := c.DoWithStringReply("SELECT", strconv.Itoa(dbId))
 			if reply != "OK" {
-				log.Panicf("scanStandaloneReader select db failed. db=[%d]", dbId)
+				logger.Panicf("scanStandaloneReader select db failed. db=[%d]", dbId)
 			}
 		}
 
@@ -163,7 +175,7 @@ func (r *scanStandaloneReader) scan() {
 		for {
 			select {
 			case <-r.ctx.Done():
-				log.Infof("[%s] scanStandaloneReader scan finished.", r.stat.Name)
+				logger.Infof("[%s] scanStandaloneReader scan finished.", r.stat.Name)
 				r.needDumpQueue.Close()
 				return
 			default:
@@ -179,6 +191,14 @@ func (r *scanStandaloneReader) scan() {
 			r.stat.ScanCursor = cursor
 			r.stat.ScanDbId = dbId
 			r.stat.ScanPercentByDbId = fmt.Sprintf("%.2f%%", float64(bits.Reverse64(cursor))/float64(^uint(0))*100)
+			// the scan of all dbs is done up to the dbs scanned plus the fraction of the current one
+			done := float64(dbInx)
+			if cursor != 0 {
+				done += float64(bits.Reverse64(cursor)) / float64(^uint64(0))
+			} else {
+				done += 1
+			}
+			r.updateProgress(done)
 
 			if cursor == 0 {
 				break
@@ -186,18 +206,24 @@ func (r *scanStandaloneReader) scan() {
 		}
 	}
 	r.stat.ScanFinished = true
+	r.stat.ScanEtaSec = 0
 	if !r.opts.KSN {
 		r.needDumpQueue.Close()
 	}
 }
 
+func (r *scanStandaloneReader) updateProgress(done float64) {
+	r.progress.update(atomic.LoadInt64(&r.stat.SentKeys), atomic.LoadInt64(&r.stat.SentBytes), done, time.Now())
+	r.stat.KeysPerSec, r.stat.BytesPerSec, r.stat.ScanEtaSec = r.progress.stat(float64(len(r.dbs)))
+}
+
 func (r *scanStandaloneReader) dump() {
 	nowDbId := 0
 	r.dumpClient = client.NewRedisClient(r.ctx, r.opts.Address, r.opts.Username, r.opts.Password, r.opts.Tls, r.opts.PreferReplica)
 	// Support prefer_replica=true in both Cluster and Standalone mode
 	if r.opts.PreferReplica {
 		r.dumpClient.Do("READONLY")
-		log.Infof("running dump() in read-only mode")
+		logger.Infof("running dump() in read-only mode")
 	}
 
 	for item := range r.needDumpQueue.Ch {
@@ -214,7 +240,7 @@ func (r *scanStandaloneReader) dump() {
 		r.needRestoreChan <- &needRestoreItem{dbId, key}
 	}
 	close(r.needRestoreChan)
-	log.Infof("[%s] scanStandaloneReader dump finished.", r.stat.Name)
+	logger.Infof("[%s] scanStandaloneReader dump finished.", r.stat.Name)
 }
 
 func (r *scanStandaloneReader) restore() {
@@ -225,7 +251,7 @@ func (r *scanStandaloneReader) restore() {
 		if nowDbId != dbId {
 			reply, err := r.dumpClient.Receive()
 			if err != nil || reply != "OK" {
-				log.Panicf("scanStandaloneReader select db failed. db=[%d]", dbId)
+				logger.Panicf("scanStandaloneReader select db failed. db=[%d]", dbId)
 			}
 			nowDbId = dbId
 		}
@@ -234,9 +260,9 @@ func (r *scanStandaloneReader) restore() {
 		if errors.Is(err1, proto.Nil) {
 			continue // key not exist
 		} else if err1 != nil {
-			log.Panicf(err1.Error())
+			logger.Panicf(err1.Error())
 		} else if err2 != nil {
-			log.Panicf(err2.Error())
+			logger.Panicf(err2.Error())
 		}
 		dump := iDump.(string)
 		pttl := int(iPttl.(int64))
@@ -246,36 +272,48 @@ func (r *scanStandaloneReader) restore() {
 		if pttl == -1 {
 			pttl = 0 // -1 means no expire
 		}
-		if uint64(len(dump)) > config.Opt.Advanced.TargetRedisProtoMaxBulkLen {
-			log.Warnf("key=[%s] dump len=[%d] too large, split it. This is not a good practice in Redis.", key, len(dump))
+		size := int64(len(dump) - 11) // without the type byte, the version and the checksum
+		atomic.AddInt64(&r.stat.SentKeys, 1)
+		atomic.AddInt64(&r.stat.SentBytes, int64(len(dump)))
+		tooLarge := uint64(len(dump)) > config.Opt.Advanced.TargetRedisProtoMaxBulkLen
+		if tooLarge || transform.MasksKey(key) { // the payload of RESTORE can not be masked
+			if tooLarge {
+				logger.Warnf("key=[%s] dump len=[%d] too large, split it. This is not a good practice in Redis.", key, len(dump))
+			}
 			typeByte := dump[0]
 			anotherReader := strings.NewReader(dump[1 : len(dump)-10])
 			o := types.ParseObject(anotherReader, typeByte, key)
-			cmdC := o.Rewrite()
-			for cmd := range cmdC {
-				e := entry.NewEntry()
-				e.DbId = dbId
-				e.Argv = cmd
-				r.ch <- e
-			}
-			if pttl != 0 {
-				e := entry.NewEntry()
-				e.DbId = dbId
-				e.Argv = []string{"PEXPIRE", key, strconv.Itoa(pttl)}
-				r.ch <- e
+			base := &entry.Entry{
+				DbId:      dbId,
+				ValueType: types.TypeName(typeByte),
+				ValueSize: size,
+				Phase:     entry.PhaseRDB,
 			}
+			rdb.SendRewrittenObject(r.ch, base, key, o, int64(pttl))
 		} else {
-			argv := []string{"RESTORE", key, strconv.Itoa(pttl), dump}
+			ttlMs := int64(pttl)
+			if pttl == 0 {
+				ttlMs = -1
+			}
+			restoreTTL := transform.ApplyTTLPolicy(ttlMs)
+			if restoreTTL == -1 {
+				restoreTTL = 0
+			}
+			argv := []string{"RESTORE", key, strconv.FormatInt(restoreTTL, 10), dump}
 			if config.Opt.Advanced.RDBRestoreCommandBehavior == "rewrite" {
 				argv = append(argv, "replace")
 			}
 			r.ch <- &entry.Entry{
-				DbId: dbId,
-				Argv: argv,
+				DbId:      dbId,
+				Argv:      argv,
+				ValueType: types.TypeName(dump[0]),
+				ValueSize: size,
+				TTLMs:     ttlMs,
+				Phase:     entry.PhaseRDB,
 			}
 		}
 	}
-	log.Infof("[%s] scanStandaloneReader restore finished.", r.stat.Name)
+	logger.Infof("[%s] scanStandaloneReader restore finished.", r.stat.Name)
 	close(r.ch)
 }
 
@@ -283,11 +321,25 @@ func (r *scanStandaloneReader) Status() interface{} {
 	return r.stat
 }
 
+func (r *scanStandaloneReader) Metrics() []status.Metric {
+	finished := 0.0
+	if r.stat.ScanFinished {
+		finished = 1
+	}
+	return []status.Metric{
+		status.Gauge("redis_shake_reader_scan_finished", "Whether the scan of the source is finished.", finished, "name", r.stat.Name),
+		status.Gauge("redis_shake_reader_scan_need_update_keys", "Keys notified by keyspace notifications and waiting to be dumped.", float64(r.stat.NeedUpdateCount), "name", r.stat.Name),
+		status.Counter("redis_shake_reader_scan_sent_keys", "Keys dumped from the source and sent to the writer.", float64(atomic.LoadInt64(&r.stat.SentKeys)), "name", r.stat.Name),
+		status.Gauge("redis_shake_reader_scan_eta_seconds", "Estimated seconds to scan all the dbs, -1 means unknown.", r.stat.ScanEtaSec, "name", r.stat.Name),
+	}
+}
+
 func (r *scanStandaloneReader) StatusString() string {
 	if r.stat.ScanFinished {
 		return fmt.Sprintf("need_update_count=[%d]", r.stat.NeedUpdateCount)
 	}
-	return fmt.Sprintf("scan_dbid=[%d], scan_percent=[%s], need_update_count=[%d]", r.stat.ScanDbId, r.stat.ScanPercentByDbId, r.stat.NeedUpdateCount)
+	return fmt.Sprintf("scan_dbid=[%d], scan_percent=[%s], need_update_count=[%d], keys=[%d], %s", r.stat.ScanDbId, r.stat.ScanPercentByDbId,
+		r.stat.NeedUpdateCount, atomic.LoadInt64(&r.stat.SentKeys), formatProgress(r.stat.KeysPerSec, r.stat.BytesPerSec, r.stat.ScanEtaSec))
 }
 
 func (r *scanStandaloneReader) StatusConsistent() bool {
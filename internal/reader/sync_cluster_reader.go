@@ -5,7 +5,7 @@ import (
 	"fmt"
 
 	"RedisShake/internal/entry"
-	"RedisShake/internal/log"
+	"RedisShake/internal/status"
 	"RedisShake/internal/utils"
 )
 
@@ -16,9 +16,9 @@ type syncClusterReader struct {
 
 func NewSyncClusterReader(ctx context.Context, opts *SyncReaderOptions) Reader {
 	addresses, _ := utils.GetRedisClusterNodes(ctx, opts.Address, opts.Username, opts.Password, opts.Tls, opts.PreferReplica)
-	log.Debugf("get redis cluster nodes:")
+	logger.Debugf("get redis cluster nodes:")
 	for _, address := range addresses {
-		log.Debugf("%s", address)
+		logger.Debugf("%s", address)
 	}
 	rd := &syncClusterReader{}
 	for _, address := range addresses {
@@ -46,6 +46,18 @@ func (rd *syncClusterReader) Status() interface{} {
 	return stat
 }
 
+func (rd *syncClusterReader) Metrics() []status.Metric {
+	return status.CollectMetrics(rd.readers)
+}
+
+func (rd *syncClusterReader) Healthy() error {
+	return status.CheckHealthy(rd.readers)
+}
+
+func (rd *syncClusterReader) Ready() error {
+	return status.CheckReady(rd.readers)
+}
+
 func (rd *syncClusterReader) StatusString() string {
 	rd.statusId += 1
 	rd.statusId %= len(rd.readers)
@@ -11,13 +11,15 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"RedisShake/internal/client"
 	"RedisShake/internal/config"
 	"RedisShake/internal/entry"
-	"RedisShake/internal/log"
+	"RedisShake/internal/hook"
 	"RedisShake/internal/rdb"
+	"RedisShake/internal/status"
 	"RedisShake/internal/utils"
 	rotate "RedisShake/internal/utils/file_rotate"
 
@@ -56,6 +58,10 @@ type syncStandaloneReader struct {
 
 	rd *bufio.Reader
 
+	lag          lagTracker
+	rdbProgress  progressMeter
+	lastReceived int64 // unix nano of the last time data is received from the source
+
 	stat struct {
 		Name    string `json:"name"`
 		Address string `json:"address"`
@@ -65,18 +71,23 @@ type syncStandaloneReader struct {
 		Status State `json:"status"`
 
 		// rdb info
-		RdbFileSizeBytes int64  `json:"rdb_file_size_bytes"` // bytes of the rdb file
-		RdbFileSizeHuman string `json:"rdb_file_size_human"`
-		RdbReceivedBytes int64  `json:"rdb_received_bytes"` // bytes of RDB received from master
-		RdbReceivedHuman string `json:"rdb_received_human"`
-		RdbSentBytes     int64  `json:"rdb_sent_bytes"` // bytes of RDB sent to chan
-		RdbSentHuman     string `json:"rdb_sent_human"`
+		RdbFileSizeBytes int64   `json:"rdb_file_size_bytes"` // bytes of the rdb file
+		RdbFileSizeHuman string  `json:"rdb_file_size_human"`
+		RdbReceivedBytes int64   `json:"rdb_received_bytes"` // bytes of RDB received from master
+		RdbReceivedHuman string  `json:"rdb_received_human"`
+		RdbSentBytes     int64   `json:"rdb_sent_bytes"` // bytes of RDB sent to chan
+		RdbSentHuman     string  `json:"rdb_sent_human"`
+		RdbSentKeys      int64   `json:"rdb_sent_keys"` // keys of RDB sent to chan
+		RdbKeysPerSec    float64 `json:"rdb_keys_per_sec"`
+		RdbBytesPerSec   float64 `json:"rdb_bytes_per_sec"`
+		RdbEtaSec        float64 `json:"rdb_eta_sec"` // estimated seconds to send the rest of RDB, -1 means unknown
 
 		// aof info
-		AofReceivedOffset int64  `json:"aof_received_offset"` // offset of AOF received from master
-		AofSentOffset     int64  `json:"aof_sent_offset"`     // offset of AOF sent to chan
-		AofReceivedBytes  int64  `json:"aof_received_bytes"`  // bytes of AOF received from master
-		AofReceivedHuman  string `json:"aof_received_human"`
+		AofReceivedOffset int64   `json:"aof_received_offset"` // offset of AOF received from master
+		AofSentOffset     int64   `json:"aof_sent_offset"`     // offset of AOF sent to chan
+		AofReceivedBytes  int64   `json:"aof_received_bytes"`  // bytes of AOF received from master
+		AofReceivedHuman  string  `json:"aof_received_human"`
+		AofLagSec         float64 `json:"aof_lag_sec"` // estimated seconds the sent offset is behind the source
 	}
 }
 
@@ -88,8 +99,10 @@ func NewSyncStandaloneReader(ctx context.Context, opts *SyncReaderOptions) Reade
 	r.stat.Name = "reader_" + strings.Replace(opts.Address, ":", "_", -1)
 	r.stat.Address = opts.Address
 	r.stat.Status = kHandShake
+	r.stat.RdbEtaSec = -1
 	r.stat.Dir = utils.GetAbsPath(r.stat.Name)
 	utils.CreateEmptyDir(r.stat.Dir)
+	r.markReceived()
 	return r
 }
 
@@ -99,15 +112,23 @@ func (r *syncStandaloneReader) StartRead(ctx context.Context) []chan *entry.Entr
 	go func() {
 		r.sendReplconfListenPort()
 		r.sendPSync()
+		hook.Trigger(hook.HandshakeDone, r.stat.Name, "offset=[%d]", r.stat.AofReceivedOffset)
 		rdbFilePath := r.receiveRDB()
+		hook.Trigger(hook.RdbReceived, r.stat.Name, "size=[%s]", r.stat.RdbFileSizeHuman)
 		startOffset := r.stat.AofReceivedOffset
 		go r.sendReplconfAck() // start sent replconf ack
 		go r.receiveAOF(r.rd)
 		if r.opts.SyncRdb {
 			r.sendRDB(rdbFilePath)
+			if r.ctx.Err() == nil { // not stopped halfway
+				hook.Trigger(hook.RdbApplied, r.stat.Name, "keys=[%d]", r.stat.RdbSentKeys)
+			}
 		}
 		if r.opts.SyncAof {
 			r.stat.Status = kSyncAof
+			if hook.Enabled(hook.LagAboveThreshold) && config.Opt.Hook.LagThreshold > 0 {
+				go r.watchLag()
+			}
 			r.sendAOF(startOffset)
 		}
 		close(r.ch)
@@ -122,7 +143,7 @@ func (r *syncStandaloneReader) sendReplconfListenPort() {
 	r.client.Send(argv...)
 	_, err := r.client.Receive()
 	if err != nil {
-		log.Warnf("[%s] send replconf command to redis server failed. error=[%v]", r.stat.Name, err)
+		logger.Warnf("[%s] send replconf command to redis server failed. error=[%v]", r.stat.Name, err)
 	}
 }
 
@@ -131,7 +152,7 @@ func (r *syncStandaloneReader) sendPSync() {
 		argv := []interface{}{"REPLCONF", "CAPA", "EOF"}
 		reply := r.client.DoWithStringReply(argv...)
 		if reply != "OK" {
-			log.Warnf("[%s] send replconf capa eof to redis server failed. reply=[%v]", r.stat.Name, reply)
+			logger.Warnf("[%s] send replconf capa eof to redis server failed. reply=[%v]", r.stat.Name, reply)
 		}
 	}
 	// send PSync
@@ -151,8 +172,9 @@ func (r *syncStandaloneReader) sendPSync() {
 		}
 		bytes, err := r.rd.Peek(1)
 		if err != nil {
-			log.Panicf(err.Error())
+			logger.Panicf(err.Error())
 		}
+		r.markReceived()
 		if bytes[0] != '\n' {
 			break
 		}
@@ -161,13 +183,13 @@ func (r *syncStandaloneReader) sendPSync() {
 	reply := r.client.ReceiveString()
 	masterOffset, err := strconv.Atoi(strings.Split(reply, " ")[2])
 	if err != nil {
-		log.Panicf(err.Error())
+		logger.Panicf(err.Error())
 	}
 	r.stat.AofReceivedOffset = int64(masterOffset)
 }
 
 func (r *syncStandaloneReader) receiveRDB() string {
-	log.Debugf("[%s] source db is doing bgsave.", r.stat.Name)
+	logger.Debugf("[%s] source db is doing bgsave.", r.stat.Name)
 	r.stat.Status = kWaitBgsave
 	timeStart := time.Now()
 	// format: \n\n\n$<length>\r\n<rdb>
@@ -175,48 +197,49 @@ func (r *syncStandaloneReader) receiveRDB() string {
 	for {
 		b, err := r.rd.ReadByte()
 		if err != nil {
-			log.Panicf(err.Error())
+			logger.Panicf(err.Error())
 		}
+		r.markReceived()
 		if b == '\n' { // heartbeat
 			continue
 		}
 		if b != '$' {
-			log.Panicf("[%s] invalid rdb format. b=[%s]", r.stat.Name, string(b))
+			logger.Panicf("[%s] invalid rdb format. b=[%s]", r.stat.Name, string(b))
 		}
 		break
 	}
-	log.Debugf("[%s] source db bgsave finished. timeUsed=[%.2f]s", r.stat.Name, time.Since(timeStart).Seconds())
+	logger.Debugf("[%s] source db bgsave finished. timeUsed=[%.2f]s", r.stat.Name, time.Since(timeStart).Seconds())
 	marker, err := r.rd.ReadString('\n')
 	if err != nil {
-		log.Panicf(err.Error())
+		logger.Panicf(err.Error())
 	}
 	marker = strings.TrimSpace(marker)
 
 	// create rdb file
 	rdbFilePath, err := filepath.Abs(r.stat.Name + "/dump.rdb")
 	if err != nil {
-		log.Panicf(err.Error())
+		logger.Panicf(err.Error())
 	}
 	timeStart = time.Now()
-	log.Debugf("[%s] start receiving RDB. path=[%s]", r.stat.Name, rdbFilePath)
+	logger.Debugf("[%s] start receiving RDB. path=[%s]", r.stat.Name, rdbFilePath)
 	rdbFileHandle, err := os.OpenFile(rdbFilePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
-		log.Panicf(err.Error())
+		logger.Panicf(err.Error())
 	}
 
 	// receive rdb
 	r.stat.Status = kReceiveRdb
 	if strings.HasPrefix(marker, "EOF") {
-		log.Infof("[%s] source db supoort diskless sync capability.", r.stat.Name)
+		logger.Infof("[%s] source db supoort diskless sync capability.", r.stat.Name)
 		r.receiveRDBWithDiskless(marker, rdbFileHandle)
 	} else {
 		r.receiveRDBWithoutDiskless(marker, rdbFileHandle)
 	}
 	err = rdbFileHandle.Close()
 	if err != nil {
-		log.Panicf(err.Error())
+		logger.Panicf(err.Error())
 	}
-	log.Debugf("[%s] save RDB finished. timeUsed=[%.2f]s", r.stat.Name, time.Since(timeStart).Seconds())
+	logger.Debugf("[%s] save RDB finished. timeUsed=[%.2f]s", r.stat.Name, time.Since(timeStart).Seconds())
 	return rdbFilePath
 }
 
@@ -226,23 +249,24 @@ func (r *syncStandaloneReader) receiveRDBWithDiskless(marker string, wt io.Write
 
 	marker = strings.Split(marker, ":")[1]
 	if len(marker) != 40 {
-		log.Panicf("[%s] invalid len of EOF marker. value=[%s]", r.stat.Name, marker)
+		logger.Panicf("[%s] invalid len of EOF marker. value=[%s]", r.stat.Name, marker)
 	}
-	log.Infof("meet EOF begin marker: %s", marker)
+	logger.Infof("meet EOF begin marker: %s", marker)
 	bMarker := []byte(marker)
 	goon := true
 	for goon {
 		n, err := r.rd.Read(buf[:bufSize])
 		if err != nil {
-			log.Panicf(err.Error())
+			logger.Panicf(err.Error())
 		}
+		r.markReceived()
 		buffer := buf[:n]
 		if bytes.Contains(buffer, bMarker) {
-			log.Infof("meet EOF end marker.")
+			logger.Infof("meet EOF end marker.")
 			// replace it
 			fi := bytes.Index(buffer, bMarker)
 			if len(buffer[fi+40:]) > 0 {
-				log.Warnf("data after end marker will be discarded: %s", string(buffer[fi+40:]))
+				logger.Warnf("data after end marker will be discarded: %s", string(buffer[fi+40:]))
 			}
 			buffer = buffer[:fi]
 
@@ -251,7 +275,7 @@ func (r *syncStandaloneReader) receiveRDBWithDiskless(marker string, wt io.Write
 
 		_, err = wt.Write(buffer)
 		if err != nil {
-			log.Panicf(err.Error())
+			logger.Panicf(err.Error())
 		}
 
 		r.stat.RdbFileSizeBytes += int64(n)
@@ -264,9 +288,9 @@ func (r *syncStandaloneReader) receiveRDBWithDiskless(marker string, wt io.Write
 func (r *syncStandaloneReader) receiveRDBWithoutDiskless(marker string, wt io.Writer) {
 	length, err := strconv.ParseInt(marker, 10, 64)
 	if err != nil {
-		log.Panicf(err.Error())
+		logger.Panicf(err.Error())
 	}
-	log.Debugf("[%s] rdb file size: [%v]", r.stat.Name, humanize.IBytes(uint64(length)))
+	logger.Debugf("[%s] rdb file size: [%v]", r.stat.Name, humanize.IBytes(uint64(length)))
 	r.stat.RdbFileSizeBytes = length
 	r.stat.RdbFileSizeHuman = humanize.IBytes(uint64(length))
 
@@ -280,12 +304,13 @@ func (r *syncStandaloneReader) receiveRDBWithoutDiskless(marker string, wt io.Wr
 		}
 		n, err := r.rd.Read(buf[:readOnce])
 		if err != nil {
-			log.Panicf(err.Error())
+			logger.Panicf(err.Error())
 		}
+		r.markReceived()
 		remainder -= int64(n)
 		_, err = wt.Write(buf[:n])
 		if err != nil {
-			log.Panicf(err.Error())
+			logger.Panicf(err.Error())
 		}
 
 		r.stat.RdbReceivedBytes += int64(n)
@@ -294,7 +319,7 @@ func (r *syncStandaloneReader) receiveRDBWithoutDiskless(marker string, wt io.Wr
 }
 
 func (r *syncStandaloneReader) receiveAOF(rd io.Reader) {
-	log.Debugf("[%s] start receiving aof data, and save to file", r.stat.Name)
+	logger.Debugf("[%s] start receiving aof data, and save to file", r.stat.Name)
 	aofWriter := rotate.NewAOFWriter(r.stat.Name, r.stat.Dir, r.stat.AofReceivedOffset)
 	defer aofWriter.Close()
 	buf := make([]byte, 16*1024) // 16KB is enough for writing file
@@ -305,30 +330,35 @@ func (r *syncStandaloneReader) receiveAOF(rd io.Reader) {
 		default:
 			n, err := rd.Read(buf)
 			if err != nil {
-				log.Panicf(err.Error())
+				logger.Panicf(err.Error())
 			}
+			r.markReceived()
 			r.stat.AofReceivedBytes += int64(n)
 			r.stat.AofReceivedHuman = humanize.IBytes(uint64(r.stat.AofReceivedBytes))
 			aofWriter.Write(buf[:n])
 			r.stat.AofReceivedOffset += int64(n)
+			r.lag.received(r.stat.AofReceivedOffset, time.Now())
 		}
 	}
 }
 
 func (r *syncStandaloneReader) sendRDB(rdbFilePath string) {
 	// start parse rdb
-	log.Debugf("[%s] start sending RDB to target", r.stat.Name)
+	logger.Debugf("[%s] start sending RDB to target", r.stat.Name)
 	r.stat.Status = kSyncRdb
-	updateFunc := func(offset int64) {
+	updateFunc := func(offset int64, keys int64) {
 		r.stat.RdbSentBytes = offset
 		r.stat.RdbSentHuman = humanize.IBytes(uint64(offset))
+		r.stat.RdbSentKeys = keys
+		r.rdbProgress.update(keys, offset, float64(offset), time.Now())
+		r.stat.RdbKeysPerSec, r.stat.RdbBytesPerSec, r.stat.RdbEtaSec = r.rdbProgress.stat(float64(r.stat.RdbFileSizeBytes))
 	}
 	rdbLoader := rdb.NewLoader(r.stat.Name, updateFunc, rdbFilePath, r.ch)
 	r.DbId = rdbLoader.ParseRDB(r.ctx)
-	log.Debugf("[%s] send RDB finished", r.stat.Name)
+	logger.Debugf("[%s] send RDB finished", r.stat.Name)
 	// delete file
 	_ = os.Remove(rdbFilePath)
-	log.Debugf("[%s] delete RDB file", r.stat.Name)
+	logger.Debugf("[%s] delete RDB file", r.stat.Name)
 }
 
 func (r *syncStandaloneReader) sendAOF(offset int64) {
@@ -336,6 +366,7 @@ func (r *syncStandaloneReader) sendAOF(offset int64) {
 	aofReader := rotate.NewAOFReader(r.stat.Name, r.stat.Dir, offset)
 	defer aofReader.Close()
 	r.client.SetBufioReader(bufio.NewReader(aofReader))
+	txnFilter := &loopTxnFilter{}
 	for {
 		select {
 		case <-r.ctx.Done():
@@ -347,7 +378,7 @@ func (r *syncStandaloneReader) sendAOF(offset int64) {
 			if strings.EqualFold(argv[0], "select") {
 				DbId, err := strconv.Atoi(argv[1])
 				if err != nil {
-					log.Panicf(err.Error())
+					logger.Panicf(err.Error())
 				}
 				r.DbId = DbId
 				continue
@@ -365,7 +396,7 @@ func (r *syncStandaloneReader) sendAOF(offset int64) {
 				continue
 			}
 			// txn
-			if strings.EqualFold(argv[0], "multi") || strings.EqualFold(argv[0], "exec") {
+			if txnFilter.drop(argv) {
 				continue
 			}
 			// sentinel
@@ -376,11 +407,38 @@ func (r *syncStandaloneReader) sendAOF(offset int64) {
 			e := entry.NewEntry()
 			e.Argv = argv
 			e.DbId = r.DbId
+			e.Phase = entry.PhaseAOF
+			e.Offset = r.stat.AofSentOffset
 			r.ch <- e
 		}
 	}
 }
 
+// loopTxnFilter unwraps the transactions of the source, and drops those written
+// by redis-shake in bidirectional sync, whose first command sets a marker key.
+type loopTxnFilter struct {
+	afterMulti bool // the previous command is MULTI
+	skip       bool // the transaction is written by redis-shake
+}
+
+// drop returns whether argv is not synced. MULTI and EXEC are always dropped.
+func (f *loopTxnFilter) drop(argv []string) bool {
+	if strings.EqualFold(argv[0], "multi") {
+		f.afterMulti = true
+		return true
+	}
+	if strings.EqualFold(argv[0], "exec") {
+		f.afterMulti = false
+		f.skip = false
+		return true
+	}
+	if f.afterMulti {
+		f.afterMulti = false
+		f.skip = len(argv) > 1 && strings.EqualFold(argv[0], "set") && utils.IsLoopMarkerKey(argv[1])
+	}
+	return f.skip
+}
+
 // sendReplconfAck send replconf ack to master to keep heartbeat between redis-shake and source redis.
 func (r *syncStandaloneReader) sendReplconfAck() {
 	ticker := time.NewTicker(time.Millisecond * 100)
@@ -398,15 +456,89 @@ func (r *syncStandaloneReader) sendReplconfAck() {
 }
 
 func (r *syncStandaloneReader) Status() interface{} {
+	r.updateLag()
 	return r.stat
 }
 
+func (r *syncStandaloneReader) updateLag() {
+	r.stat.AofLagSec = r.lag.lag(r.stat.AofSentOffset, time.Now())
+}
+
+func (r *syncStandaloneReader) markReceived() {
+	atomic.StoreInt64(&r.lastReceived, time.Now().UnixNano())
+}
+
+// Healthy fails when nothing is received for health_timeout seconds. The source
+// sends heartbeats while doing bgsave and pings its replicas periodically, so a
+// healthy connection never stays silent for long.
+func (r *syncStandaloneReader) Healthy() error {
+	timeout := time.Duration(config.Opt.Advanced.HealthTimeout) * time.Second
+	silent := time.Since(time.Unix(0, atomic.LoadInt64(&r.lastReceived)))
+	if timeout > 0 && silent > timeout {
+		return fmt.Errorf("[%s] received nothing from the source for %.0fs", r.stat.Name, silent.Seconds())
+	}
+	return nil
+}
+
+// Ready fails until the snapshot is synced and the lag is at most
+// ready_max_lag seconds.
+func (r *syncStandaloneReader) Ready() error {
+	if r.stat.Status != kSyncAof {
+		return fmt.Errorf("[%s] %s", r.stat.Name, r.stat.Status)
+	}
+	r.updateLag()
+	if r.stat.AofLagSec > float64(config.Opt.Advanced.ReadyMaxLag) {
+		return fmt.Errorf("[%s] lag=[%.1fs] exceeds ready_max_lag=[%ds]", r.stat.Name, r.stat.AofLagSec, config.Opt.Advanced.ReadyMaxLag)
+	}
+	return nil
+}
+
+// watchLag triggers lag_above_threshold when the lag exceeds lag_threshold, and
+// triggers it again only after the lag has fallen below.
+func (r *syncStandaloneReader) watchLag() {
+	threshold := float64(config.Opt.Hook.LagThreshold)
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	above := false
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		lag := r.lag.lag(r.stat.AofSentOffset, time.Now())
+		if lag > threshold && !above {
+			hook.Trigger(hook.LagAboveThreshold, r.stat.Name, "lag=[%.1fs], lag_threshold=[%ds]", lag, config.Opt.Hook.LagThreshold)
+		}
+		above = lag > threshold
+	}
+}
+
+func (r *syncStandaloneReader) Metrics() []status.Metric {
+	r.updateLag()
+	name := r.stat.Name
+	return []status.Metric{
+		status.Gauge("redis_shake_reader_rdb_size_bytes", "Size of the RDB of the source.", float64(r.stat.RdbFileSizeBytes), "name", name),
+		status.Counter("redis_shake_reader_rdb_received_bytes", "Bytes of the RDB received from the source.", float64(r.stat.RdbReceivedBytes), "name", name),
+		status.Counter("redis_shake_reader_rdb_sent_bytes", "Bytes of the RDB parsed and sent to the writer.", float64(r.stat.RdbSentBytes), "name", name),
+		status.Counter("redis_shake_reader_rdb_sent_keys", "Keys of the RDB parsed and sent to the writer.", float64(r.stat.RdbSentKeys), "name", name),
+		status.Gauge("redis_shake_reader_rdb_eta_seconds", "Estimated seconds to send the rest of the RDB, -1 means unknown.", r.stat.RdbEtaSec, "name", name),
+		status.Gauge("redis_shake_reader_aof_received_offset", "Replication offset received from the source.", float64(r.stat.AofReceivedOffset), "name", name),
+		status.Gauge("redis_shake_reader_aof_sent_offset", "Replication offset sent to the writer.", float64(r.stat.AofSentOffset), "name", name),
+		status.Gauge("redis_shake_reader_aof_lag_bytes", "Bytes of the replication stream received but not sent to the writer yet.", float64(r.stat.AofReceivedOffset-r.stat.AofSentOffset), "name", name),
+		status.Gauge("redis_shake_reader_aof_lag_seconds", "Estimated seconds the replication stream sent to the writer is behind the source.", r.stat.AofLagSec, "name", name),
+		status.Gauge("redis_shake_reader_state", "State of the reader, the value is always 1.", 1, "name", name, "state", string(r.stat.Status)),
+	}
+}
+
 func (r *syncStandaloneReader) StatusString() string {
 	if r.stat.Status == kSyncRdb {
-		return fmt.Sprintf("%s, size=[%s/%s]", r.stat.Status, r.stat.RdbSentHuman, r.stat.RdbFileSizeHuman)
+		return fmt.Sprintf("%s, size=[%s/%s], keys=[%d], %s", r.stat.Status, r.stat.RdbSentHuman, r.stat.RdbFileSizeHuman,
+			r.stat.RdbSentKeys, formatProgress(r.stat.RdbKeysPerSec, r.stat.RdbBytesPerSec, r.stat.RdbEtaSec))
 	}
 	if r.stat.Status == kSyncAof {
-		return fmt.Sprintf("%s, diff=[%v]", r.stat.Status, -r.stat.AofSentOffset+r.stat.AofReceivedOffset)
+		r.updateLag()
+		return fmt.Sprintf("%s, diff=[%v], lag=[%.1fs]", r.stat.Status, -r.stat.AofSentOffset+r.stat.AofReceivedOffset, r.stat.AofLagSec)
 	}
 	return string(r.stat.Status)
 }
@@ -0,0 +1,43 @@
+package reader
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"RedisShake/internal/config"
+)
+
+func TestLoopTxnFilter(t *testing.T) {
+	config.Opt.Advanced.Bidirectional = true
+	config.Opt.Advanced.BidirectionalMarker = "redis-shake:loop:"
+	defer func() { config.Opt.Advanced.Bidirectional = false }()
+
+	stream := []string{
+		"SET a 1",
+		"MULTI", "SET redis-shake:loop:{x} 1", "SET b 2", "EXEC", // written by redis-shake
+		"MULTI", "SET c 3", "SET redis-shake:loop:{x} 1", "EXEC", // written by a client
+		"set d 4",
+		"multi", "set redis-shake:loop:{y} 1", "del e", "exec",
+		"INCR f",
+	}
+	f := &loopTxnFilter{}
+	var synced []string
+	for _, cmd := range stream {
+		if !f.drop(strings.Fields(cmd)) {
+			synced = append(synced, cmd)
+		}
+	}
+	want := []string{"SET a 1", "SET c 3", "SET redis-shake:loop:{x} 1", "set d 4", "INCR f"}
+	if !slices.Equal(synced, want) {
+		t.Errorf("synced = %q, want %q", synced, want)
+	}
+
+	// markers are ordinary keys without bidirectional sync
+	config.Opt.Advanced.Bidirectional = false
+	f = &loopTxnFilter{}
+	f.drop([]string{"MULTI"})
+	if f.drop([]string{"SET", "redis-shake:loop:{x}", "1"}) {
+		t.Error("a marker-led transaction is dropped without bidirectional sync")
+	}
+}
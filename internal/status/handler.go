@@ -7,10 +7,15 @@ import (
 	"time"
 
 	"RedisShake/internal/config"
+	"RedisShake/internal/control"
 	"RedisShake/internal/log"
 )
 
-func Handler(w http.ResponseWriter, _ *http.Request) {
+func Handler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
 	w.Header().Add("Content-Type", "application/json")
 
 	bytesChannel := make(chan []byte, 1)
@@ -34,7 +39,7 @@ func Handler(w http.ResponseWriter, _ *http.Request) {
 		}
 	case <-time.After(time.Second * 3):
 		log.Warnf("write status info timeout")
-		w.WriteHeader(http.StatusRequestTimeout)
+		w.WriteHeader(http.StatusServiceUnavailable)
 	}
 }
 
@@ -42,11 +47,20 @@ func setStatusPort() {
 	if config.Opt.Advanced.StatusPort != 0 {
 		go func() {
 			addr := fmt.Sprintf(":%d", config.Opt.Advanced.StatusPort)
-			if err := http.ListenAndServe(addr, http.HandlerFunc(Handler)); err != nil {
+			mux := http.NewServeMux()
+			mux.HandleFunc("/", Handler)
+			mux.HandleFunc("/metrics", MetricsHandler)
+			mux.HandleFunc("/healthz", HealthzHandler)
+			mux.HandleFunc("/readyz", ReadyzHandler)
+			mux.HandleFunc("/control", control.Handler)
+			mux.HandleFunc("/control/", control.Handler)
+			if err := http.ListenAndServe(addr, mux); err != nil {
 				log.Panicf(err.Error())
 			}
 		}()
 		log.Infof("status information: http://localhost:%v", config.Opt.Advanced.StatusPort)
+		log.Infof("prometheus metrics: http://localhost:%v/metrics", config.Opt.Advanced.StatusPort)
+		log.Infof("health probes: http://localhost:%v/healthz, http://localhost:%v/readyz", config.Opt.Advanced.StatusPort, config.Opt.Advanced.StatusPort)
 		log.Infof("status information: watch -n 0.3 'curl -s http://localhost:%v | python -m json.tool'", config.Opt.Advanced.StatusPort)
 	} else {
 		log.Infof("not set status port")
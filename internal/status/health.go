@@ -0,0 +1,123 @@
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"RedisShake/internal/log"
+)
+
+// HealthChecker is implemented by the readers and writers that hold a long
+// lived connection, Healthy returns an error when the connection looks stuck.
+type HealthChecker interface {
+	Healthy() error
+}
+
+// ReadyChecker is implemented by the readers that replicate continuously,
+// Ready returns an error until the snapshot is synced and the lag is small.
+// Other readers are ready when StatusConsistent returns true.
+type ReadyChecker interface {
+	Ready() error
+}
+
+// CheckHealthy joins the errors of the HealthChecker items of a cluster reader
+// or writer.
+func CheckHealthy[T any](items []T) error {
+	var errs []error
+	for _, item := range items {
+		if c, ok := any(item).(HealthChecker); ok {
+			errs = append(errs, c.Healthy())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckReady joins the errors of the ReadyChecker items of a cluster reader.
+func CheckReady[T any](items []T) error {
+	var errs []error
+	for _, item := range items {
+		if c, ok := any(item).(ReadyChecker); ok {
+			errs = append(errs, c.Ready())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type probeResult struct {
+	Ok     bool     `json:"ok"`
+	Errors []string `json:"errors,omitempty"`
+}
+
+// HealthzHandler serves /healthz, it fails when the connection to the source
+// or the target looks stuck.
+func HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	probe(w, checkHealthy)
+}
+
+// ReadyzHandler serves /readyz, it fails until the snapshot is synced and the
+// replication lag is small.
+func ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	probe(w, func() []error {
+		errs := checkHealthy()
+		if c, ok := theReader.(ReadyChecker); ok {
+			errs = appendError(errs, c.Ready())
+		} else if !theReader.StatusConsistent() {
+			errs = append(errs, errors.New("the reader has not caught up with the source"))
+		}
+		return errs
+	})
+}
+
+// checkHealthy must be called in ch.
+func checkHealthy() []error {
+	var errs []error
+	for _, s := range []Statusable{theReader, theWriter} {
+		if c, ok := s.(HealthChecker); ok {
+			errs = appendError(errs, c.Healthy())
+		}
+	}
+	return errs
+}
+
+func appendError(errs []error, err error) []error {
+	if err == nil {
+		return errs
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return append(errs, joined.Unwrap()...)
+	}
+	return append(errs, err)
+}
+
+// probe answers 200 when check returns no error and 503 otherwise, including
+// when the status goroutine does not answer in time.
+func probe(w http.ResponseWriter, check func() []error) {
+	w.Header().Add("Content-Type", "application/json")
+
+	resultChannel := make(chan probeResult, 1)
+
+	ch <- func() {
+		result := probeResult{Ok: true}
+		for _, err := range check() {
+			result.Ok = false
+			result.Errors = append(result.Errors, err.Error())
+		}
+		resultChannel <- result
+	}
+
+	var result probeResult
+	select {
+	case result = <-resultChannel:
+	case <-time.After(time.Second * 3):
+		log.Warnf("check status timeout")
+		result = probeResult{Errors: []string{"status timeout"}}
+	}
+	if !result.Ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		log.Warnf("write probe result failed, err=[%v]", err)
+	}
+}
@@ -0,0 +1,55 @@
+package status
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testCheckable struct {
+	consistent bool
+	healthy    error
+}
+
+func (c *testCheckable) Status() interface{}    { return nil }
+func (c *testCheckable) StatusString() string   { return "" }
+func (c *testCheckable) StatusConsistent() bool { return c.consistent }
+func (c *testCheckable) Healthy() error         { return c.healthy }
+
+func TestProbes(t *testing.T) {
+	go func() {
+		for f := range ch {
+			f()
+		}
+	}()
+	reader := &testCheckable{}
+	writer := &testCheckable{}
+	theReader, theWriter = reader, writer
+
+	get := func(handler http.HandlerFunc, target string) int {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w.Code
+	}
+	if code := get(HealthzHandler, "/healthz"); code != http.StatusOK {
+		t.Errorf("healthz = %d, want 200", code)
+	}
+	if code := get(ReadyzHandler, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz before consistent = %d, want 503", code)
+	}
+	reader.consistent = true
+	if code := get(ReadyzHandler, "/readyz"); code != http.StatusOK {
+		t.Errorf("readyz after consistent = %d, want 200", code)
+	}
+	writer.healthy = errors.Join(errors.New("writer_1 stuck"), errors.New("writer_2 stuck"))
+	if code := get(HealthzHandler, "/healthz"); code != http.StatusServiceUnavailable {
+		t.Errorf("healthz with a stuck writer = %d, want 503", code)
+	}
+	if code := get(ReadyzHandler, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Errorf("readyz with a stuck writer = %d, want 503", code)
+	}
+	if code := get(Handler, "/unknown"); code != http.StatusNotFound {
+		t.Errorf("unknown path = %d, want 404", code)
+	}
+}
@@ -0,0 +1,141 @@
+package status
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"RedisShake/internal/log"
+)
+
+// Metric is a sample served on /metrics in the Prometheus text format.
+type Metric struct {
+	Name   string
+	Help   string
+	Type   string   // counter or gauge
+	Labels []string // name and value pairs
+	Value  float64
+}
+
+// Metricable is implemented by the readers and writers that export metrics.
+// Their samples are labeled by their name, so the samples of the shards of a
+// cluster can be told apart.
+type Metricable interface {
+	Metrics() []Metric
+}
+
+func Gauge(name string, help string, value float64, labels ...string) Metric {
+	return Metric{Name: name, Help: help, Type: "gauge", Labels: labels, Value: value}
+}
+
+func Counter(name string, help string, value float64, labels ...string) Metric {
+	return Metric{Name: name, Help: help, Type: "counter", Labels: labels, Value: value}
+}
+
+// CollectMetrics returns the metrics of the Metricable items of a cluster
+// reader or writer.
+func CollectMetrics[T any](items []T) []Metric {
+	var metrics []Metric
+	for _, item := range items {
+		if m, ok := any(item).(Metricable); ok {
+			metrics = append(metrics, m.Metrics()...)
+		}
+	}
+	return metrics
+}
+
+func MetricsHandler(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Add("Content-Type", "text/plain; version=0.0.4")
+
+	bytesChannel := make(chan []byte, 1)
+
+	ch <- func() {
+		bytesChannel <- formatMetrics(collectMetrics())
+	}
+
+	select {
+	case data := <-bytesChannel:
+		_, err := w.Write(data)
+		if err != nil {
+			log.Warnf("write metrics failed, err=[%v]", err)
+		}
+	case <-time.After(time.Second * 3):
+		log.Warnf("write metrics timeout")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+}
+
+// collectMetrics must be called in ch.
+func collectMetrics() []Metric {
+	consistent := 0.0
+	if theReader.StatusConsistent() && theWriter.StatusConsistent() {
+		consistent = 1
+	}
+	metrics := []Metric{
+		Gauge("redis_shake_consistent", "Whether the destination has caught up with the source.", consistent),
+		Counter("redis_shake_entries_read_total", "Entries read from the source.", float64(stat.TotalEntriesCount.ReadCount)),
+		Counter("redis_shake_entries_written_total", "Entries written to the destination.", float64(stat.TotalEntriesCount.WriteCount)),
+		Counter("redis_shake_filter_dropped_total", "Entries dropped by the filter.", float64(stat.FilterDropCount)),
+		Counter("redis_shake_function_errors_total", "Errors raised by the Lua function.", float64(stat.FunctionErrorCount)),
+	}
+	for _, cmd := range sortedKeys(stat.PerCmdEntriesCount) {
+		count := stat.PerCmdEntriesCount[cmd]
+		metrics = append(metrics,
+			Counter("redis_shake_cmd_read_total", "Entries read from the source by command.", float64(count.ReadCount), "cmd", cmd),
+			Counter("redis_shake_cmd_written_total", "Entries written to the destination by command.", float64(count.WriteCount), "cmd", cmd))
+	}
+	for _, reason := range sortedKeys(stat.SkipReasons) {
+		metrics = append(metrics, Counter("redis_shake_function_skipped_total", "Entries skipped by shake.skip_reason() of the Lua function.", float64(stat.SkipReasons[reason]), "reason", reason))
+	}
+	for _, s := range []Statusable{theReader, theWriter} {
+		if m, ok := s.(Metricable); ok {
+			metrics = append(metrics, m.Metrics()...)
+		}
+	}
+	return metrics
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatMetrics writes metrics in the Prometheus text format, the samples of a
+// metric are grouped under one HELP and TYPE line.
+func formatMetrics(metrics []Metric) []byte {
+	var names []string
+	samples := make(map[string][]Metric)
+	for _, m := range metrics {
+		if _, ok := samples[m.Name]; !ok {
+			names = append(names, m.Name)
+		}
+		samples[m.Name] = append(samples[m.Name], m)
+	}
+	var buf bytes.Buffer
+	for _, name := range names {
+		first := samples[name][0]
+		fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s %s\n", name, first.Help, name, first.Type)
+		for _, m := range samples[name] {
+			buf.WriteString(name)
+			if len(m.Labels) > 0 {
+				pairs := make([]string, 0, len(m.Labels)/2)
+				for inx := 0; inx+1 < len(m.Labels); inx += 2 {
+					pairs = append(pairs, m.Labels[inx]+`="`+labelEscaper.Replace(m.Labels[inx+1])+`"`)
+				}
+				buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+			}
+			buf.WriteString(" " + strconv.FormatFloat(m.Value, 'g', -1, 64) + "\n")
+		}
+	}
+	return buf.Bytes()
+}
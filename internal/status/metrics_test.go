@@ -0,0 +1,35 @@
+package status
+
+import (
+	"testing"
+)
+
+type testMetricable string
+
+func (m testMetricable) Metrics() []Metric {
+	return []Metric{Gauge("redis_shake_test", "Test gauge.", 1.5, "name", string(m))}
+}
+
+func TestFormatMetrics(t *testing.T) {
+	metrics := []Metric{
+		Counter("redis_shake_cmd_read_total", "Entries read.", 3, "cmd", "SET"),
+		Counter("redis_shake_filter_dropped_total", "Entries dropped.", 0),
+		Counter("redis_shake_cmd_read_total", "Entries read.", 1, "cmd", `a"b\c`),
+	}
+	metrics = append(metrics, CollectMetrics([]testMetricable{"reader_1", "reader_2"})...)
+	want := `# HELP redis_shake_cmd_read_total Entries read.
+# TYPE redis_shake_cmd_read_total counter
+redis_shake_cmd_read_total{cmd="SET"} 3
+redis_shake_cmd_read_total{cmd="a\"b\\c"} 1
+# HELP redis_shake_filter_dropped_total Entries dropped.
+# TYPE redis_shake_filter_dropped_total counter
+redis_shake_filter_dropped_total 0
+# HELP redis_shake_test Test gauge.
+# TYPE redis_shake_test gauge
+redis_shake_test{name="reader_1"} 1.5
+redis_shake_test{name="reader_2"} 1.5
+`
+	if got := string(formatMetrics(metrics)); got != want {
+		t.Errorf("formatMetrics() =\n%s\nwant\n%s", got, want)
+	}
+}
@@ -16,6 +16,10 @@ type Stat struct {
 	// function
 	TotalEntriesCount  EntryCount            `json:"total_entries_count"`
 	PerCmdEntriesCount map[string]EntryCount `json:"per_cmd_entries_count"`
+	FilterDropCount    uint64                `json:"filter_drop_count"`
+	SkipReasons        map[string]uint64     `json:"skip_reasons"` // reported by shake.skip_reason() of function
+	FunctionErrorCount uint64                `json:"function_error_count"`
+	FunctionLastError  string                `json:"function_last_error"`
 	// reader
 	Reader interface{} `json:"reader"`
 	// writer
@@ -53,6 +57,25 @@ func AddWriteCount(cmd string) {
 	}
 }
 
+func AddFilterDrop() {
+	ch <- func() {
+		stat.FilterDropCount += 1
+	}
+}
+
+func AddSkipReason(reason string) {
+	ch <- func() {
+		stat.SkipReasons[reason] += 1
+	}
+}
+
+func AddFunctionError(err string) {
+	ch <- func() {
+		stat.FunctionErrorCount += 1
+		stat.FunctionLastError = err
+	}
+}
+
 func Init(r Statusable, w Statusable) {
 	theReader = r
 	theWriter = w
@@ -63,6 +86,9 @@ func Init(r Statusable, w Statusable) {
 	if stat.PerCmdEntriesCount == nil {
 		stat.PerCmdEntriesCount = make(map[string]EntryCount)
 	}
+	if stat.SkipReasons == nil {
+		stat.SkipReasons = make(map[string]uint64)
+	}
 
 	// for update reader/writer stat
 	go func() {
@@ -74,8 +100,10 @@ func Init(r Statusable, w Statusable) {
 				// update reader/writer stat
 				stat.Reader = theReader.Status()
 				stat.Writer = theWriter.Status()
-				stat.Consistent = lastConsistent && theReader.StatusConsistent() && theWriter.StatusConsistent()
-				lastConsistent = stat.Consistent
+				// consistent for two ticks in a row
+				consistent := theReader.StatusConsistent() && theWriter.StatusConsistent()
+				stat.Consistent = lastConsistent && consistent
+				lastConsistent = consistent
 				// update OPS
 				stat.TotalEntriesCount.UpdateOPS()
 				for _, cmdEntryCount := range stat.PerCmdEntriesCount {
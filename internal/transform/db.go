@@ -0,0 +1,204 @@
+package transform
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"RedisShake/internal/commands"
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+	"RedisShake/internal/log"
+)
+
+var dbMap map[int]int
+
+// sharedDbs are the destination dbs that receive the keys of more than one
+// source db, a FLUSHDB of one of the sources must not be applied to them.
+var sharedDbs map[int]bool
+
+func initDbMap() {
+	dbMap = make(map[int]int)
+	for from, to := range config.Opt.Transform.DbMap {
+		fromDb, err := strconv.Atoi(from)
+		if err != nil || fromDb < 0 || to < 0 {
+			log.Panicf("invalid db_map item. from=[%s], to=[%d]", from, to)
+		}
+		dbMap[fromDb] = to
+	}
+	sharedDbs = make(map[int]bool)
+	sources := make(map[int]int)
+	for from, to := range dbMap {
+		if from != to {
+			sources[to]++
+		}
+	}
+	for to, count := range sources {
+		if _, mapped := dbMap[to]; !mapped {
+			count++ // the db keeps its own keys
+		}
+		sharedDbs[to] = count > 1
+	}
+	if config.Opt.Transform.MergeDb && strings.Count(config.Opt.Transform.MergeDbPrefix, "%d") != 1 {
+		log.Panicf("merge_db_prefix must contain exactly one %%d. merge_db_prefix=[%s]", config.Opt.Transform.MergeDbPrefix)
+	}
+	if len(dbMap) > 0 || config.Opt.Transform.MergeDb {
+		log.Infof("transform db. db_map=[%v], merge_db=[%v], merge_db_prefix=[%s]", dbMap, config.Opt.Transform.MergeDb, config.Opt.Transform.MergeDbPrefix)
+	}
+}
+
+func mapDb(db int) int {
+	if to, ok := dbMap[db]; ok {
+		return to
+	}
+	return db
+}
+
+// mergedKey returns the name of a key of db after merging it into db 0.
+func mergedKey(db int, key string) string {
+	if db == 0 {
+		return key
+	}
+	return fmt.Sprintf(config.Opt.Transform.MergeDbPrefix, db) + key
+}
+
+// transformDb applies db_map and merge_db to e, including the db arguments of
+// MOVE, COPY and SWAPDB. It returns false if e should be dropped.
+func transformDb(e *entry.Entry) bool {
+	e.DbId = mapDb(e.DbId)
+	switch e.CmdName {
+	case "MOVE":
+		return transformMove(e)
+	case "COPY":
+		return transformCopy(e)
+	case "SWAPDB":
+		return transformSwapDb(e)
+	case "FLUSHDB":
+		if config.Opt.Transform.MergeDb || sharedDbs[e.DbId] {
+			log.Warnf("FLUSHDB of a db that receives the keys of several source dbs, skip it. db=[%d]", e.DbId)
+			return false
+		}
+	}
+	if config.Opt.Transform.MergeDb && e.DbId != 0 {
+		db := e.DbId
+		renameKeys(e, func(key string) string { return mergedKey(db, key) })
+		e.DbId = 0
+	}
+	return true
+}
+
+// transformMove handles MOVE key db. In merge mode the key is renamed to the
+// prefix of the destination db by scriptMove, which keeps the semantics of
+// MOVE that nothing is done if the source key is missing or the destination
+// key exists.
+func transformMove(e *entry.Entry) bool {
+	if len(e.Argv) != 3 {
+		return true
+	}
+	dstDb, err := strconv.Atoi(e.Argv[2])
+	if err != nil {
+		return true
+	}
+	dstDb = mapDb(dstDb)
+	if dstDb == e.DbId {
+		log.Warnf("MOVE to the same db after db mapping, skip it. db=[%d], cmd=[%s]", dstDb, e.String())
+		return false
+	}
+	if !config.Opt.Transform.MergeDb {
+		e.Argv[2] = strconv.Itoa(dstDb)
+		return true
+	}
+	src, dst := mergedKey(e.DbId, e.Argv[1]), mergedKey(dstDb, e.Argv[1])
+	if !sameSlot(e, src, dst) {
+		return false
+	}
+	e.Argv = []string{"EVAL", scriptMove, "2", src, dst}
+	e.DbId = 0
+	e.Parse()
+	return true
+}
+
+// scriptMove is MOVE between two keys of the same db. KEYS: source, destination
+const scriptMove = `if redis.call('EXISTS', KEYS[1]) == 0 then
+    return 0
+end
+return redis.call('RENAMENX', KEYS[1], KEYS[2])`
+
+// sameSlot returns whether the merged keys src and dst of e hash to the same
+// slot. A cluster destination rejects a command on keys of different slots, so
+// e is skipped with a warning otherwise.
+func sameSlot(e *entry.Entry, src string, dst string) bool {
+	slots := commands.CalcSlots([]string{src, dst})
+	if slots[0] != slots[1] {
+		log.Warnf("%s between dbs can not be merged, the keys hash to different slots, skip it. cmd=[%s], keys=[%s, %s]", e.CmdName, e.String(), src, dst)
+		return false
+	}
+	return true
+}
+
+// transformCopy handles COPY source destination [DB destination-db] [REPLACE].
+func transformCopy(e *entry.Entry) bool {
+	if len(e.Argv) < 3 {
+		return true
+	}
+	dstDb := e.DbId
+	dbInx := -1
+	for inx := 3; inx+1 < len(e.Argv); inx++ {
+		if strings.EqualFold(e.Argv[inx], "DB") {
+			db, err := strconv.Atoi(e.Argv[inx+1])
+			if err != nil {
+				return true
+			}
+			dstDb = mapDb(db)
+			dbInx = inx
+			break
+		}
+	}
+	if !config.Opt.Transform.MergeDb {
+		if dbInx != -1 {
+			e.Argv[dbInx+1] = strconv.Itoa(dstDb)
+		}
+		return true
+	}
+	src, dst := mergedKey(e.DbId, e.Argv[1]), mergedKey(dstDb, e.Argv[2])
+	if !sameSlot(e, src, dst) {
+		return false
+	}
+	argv := []string{e.Argv[0], src, dst}
+	for inx := 3; inx < len(e.Argv); inx++ {
+		if inx == dbInx {
+			inx++
+			continue
+		}
+		argv = append(argv, e.Argv[inx])
+	}
+	e.Argv = argv
+	e.DbId = 0
+	e.Parse()
+	return true
+}
+
+// transformSwapDb handles SWAPDB index1 index2, which has no equivalent once
+// the databases are merged.
+func transformSwapDb(e *entry.Entry) bool {
+	if len(e.Argv) != 3 {
+		return true
+	}
+	if config.Opt.Transform.MergeDb {
+		log.Warnf("SWAPDB can not be applied to merged dbs, skip it. cmd=[%s]", e.String())
+		return false
+	}
+	db1, err1 := strconv.Atoi(e.Argv[1])
+	db2, err2 := strconv.Atoi(e.Argv[2])
+	if err1 != nil || err2 != nil {
+		return true
+	}
+	db1, db2 = mapDb(db1), mapDb(db2)
+	if db1 == db2 {
+		log.Warnf("SWAPDB of the same db after db mapping, skip it. db=[%d], cmd=[%s]", db1, e.String())
+		return false
+	}
+	e.Argv[1] = strconv.Itoa(db1)
+	e.Argv[2] = strconv.Itoa(db2)
+	return true
+}
@@ -0,0 +1,76 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+)
+
+func testTransformDb(t *testing.T, db int, argv string, wantDb int, want string) {
+	e := entry.NewEntry()
+	e.DbId = db
+	e.Argv = strings.Split(argv, " ")
+	e.Parse()
+	entries := Transform(e)
+	if want == "" {
+		if len(entries) != 0 {
+			t.Errorf("Transform(%s) in db %d should be dropped, got %v", argv, db, entries[0].Argv)
+		}
+		return
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Transform(%s) in db %d returned %d entries", argv, db, len(entries))
+	}
+	got := strings.Join(entries[0].Argv, " ")
+	if got != want || entries[0].DbId != wantDb {
+		t.Errorf("Transform(%s) in db %d = [%s] in db %d, want [%s] in db %d", argv, db, got, entries[0].DbId, want, wantDb)
+	}
+}
+
+func TestDbMap(t *testing.T) {
+	config.Opt = config.ShakeOptions{
+		Transform: config.TransformOptions{
+			TTLMultiply: 1,
+			DbMap:       map[string]int{"3": 0, "5": 1},
+		},
+	}
+	Init()
+	testTransformDb(t, 3, "SET a 1", 0, "SET a 1")
+	testTransformDb(t, 5, "SET a 1", 1, "SET a 1")
+	testTransformDb(t, 2, "SET a 1", 2, "SET a 1")
+	testTransformDb(t, 2, "MOVE a 5", 2, "MOVE a 1")
+	testTransformDb(t, 0, "MOVE a 3", 0, "")
+	testTransformDb(t, 0, "COPY a b DB 5 REPLACE", 0, "COPY a b DB 1 REPLACE")
+	testTransformDb(t, 0, "SWAPDB 5 2", 0, "SWAPDB 1 2")
+	testTransformDb(t, 0, "SWAPDB 3 0", 0, "")
+	testTransformDb(t, 3, "FLUSHDB", 0, "") // db 0 holds the keys of db 0 and db 3
+	testTransformDb(t, 0, "FLUSHDB", 0, "")
+	testTransformDb(t, 2, "FLUSHDB", 2, "FLUSHDB")
+}
+
+func TestMergeDb(t *testing.T) {
+	config.Opt = config.ShakeOptions{
+		Transform: config.TransformOptions{
+			TTLMultiply:   1,
+			DbMap:         map[string]int{"7": 0},
+			MergeDb:       true,
+			MergeDbPrefix: "db%d:",
+		},
+	}
+	Init()
+	testTransformDb(t, 0, "SET a 1", 0, "SET a 1")
+	testTransformDb(t, 7, "SET a 1", 0, "SET a 1")
+	testTransformDb(t, 3, "MSET a 1 b 2", 0, "MSET db3:a 1 db3:b 2")
+	testTransformDb(t, 3, "MOVE {u}a 5", 0, "EVAL "+scriptMove+" 2 db3:{u}a db5:{u}a")
+	testTransformDb(t, 3, "MOVE {u}a 0", 0, "EVAL "+scriptMove+" 2 db3:{u}a {u}a")
+	testTransformDb(t, 3, "COPY {u}a {u}b DB 5 REPLACE", 0, "COPY db3:{u}a db5:{u}b REPLACE")
+	testTransformDb(t, 3, "COPY {u}a {u}b", 0, "COPY db3:{u}a db3:{u}b")
+	// a cluster destination would reject keys of different slots
+	testTransformDb(t, 3, "MOVE a 5", 0, "")
+	testTransformDb(t, 3, "COPY a b DB 5", 0, "")
+	testTransformDb(t, 3, "FLUSHDB", 0, "")
+	testTransformDb(t, 0, "FLUSHDB", 0, "")
+	testTransformDb(t, 0, "SWAPDB 1 2", 0, "")
+}
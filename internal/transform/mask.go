@@ -0,0 +1,215 @@
+package transform
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math/rand"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+	"RedisShake/internal/log"
+)
+
+type mask struct {
+	*config.MaskRule
+	keyRegex   *regexp.Regexp
+	valueRegex *regexp.Regexp
+}
+
+var masks []mask
+
+func initMasks() {
+	masks = nil
+	for inx := range config.Opt.Transform.Masks {
+		m := mask{MaskRule: &config.Opt.Transform.Masks[inx]}
+		if !slices.Contains([]string{"hash", "redact", "fake"}, m.Method) {
+			log.Panicf("invalid method of transform mask %d. method=[%s]", inx+1, m.Method)
+		}
+		var err error
+		if m.KeyRegex != "" {
+			if m.keyRegex, err = regexp.Compile(m.KeyRegex); err != nil {
+				log.Panicf("invalid key_regex of transform mask %d. key_regex=[%s], error=[%v]", inx+1, m.KeyRegex, err)
+			}
+		}
+		if m.ValueRegex != "" {
+			if m.valueRegex, err = regexp.Compile(m.ValueRegex); err != nil {
+				log.Panicf("invalid value_regex of transform mask %d. value_regex=[%s], error=[%v]", inx+1, m.ValueRegex, err)
+			}
+		}
+		masks = append(masks, m)
+	}
+	if len(masks) > 0 {
+		log.Infof("transform masks. count=[%d]", len(masks))
+	}
+}
+
+// MasksKey reports whether the values of key may be masked. The snapshot
+// readers rewrite such keys into commands instead of sending RESTORE, whose
+// payload can not be masked. The masks see the keys renamed by the rules, so
+// the names key may be renamed to are checked too.
+func MasksKey(key string) bool {
+	candidates := []string{key}
+	for inx := range rules {
+		r := &rules[inx]
+		if r.RenameKey == "" {
+			continue
+		}
+		for _, candidate := range candidates {
+			if r.keyRegex.MatchString(candidate) {
+				candidates = append(candidates, r.keyRegex.ReplaceAllString(candidate, r.RenameKey))
+			}
+		}
+	}
+	return slices.ContainsFunc(candidates, matchMasks)
+}
+
+// matchMasks reports whether a mask matches key.
+func matchMasks(key string) bool {
+	for inx := range masks {
+		if masks[inx].matchKey(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// unmaskedCommands write values that maskEntry can not mask, such as the
+// payload of RESTORE, parts of strings, the elements of lists, sets, sorted
+// sets and streams, or values copied from another key.
+var unmaskedCommands = map[string]bool{
+	"RESTORE": true, "RESTORE-ASKING": true, "COPY": true, "RENAME": true, "RENAMENX": true, "MOVE": true,
+	"SETRANGE": true, "SETBIT": true, "BITFIELD": true, "BITOP": true, "HINCRBYFLOAT": true,
+	"LPUSH": true, "RPUSH": true, "LPUSHX": true, "RPUSHX": true, "LINSERT": true, "LSET": true,
+	"LMOVE": true, "BLMOVE": true, "RPOPLPUSH": true, "BRPOPLPUSH": true,
+	"SADD": true, "SMOVE": true, "SUNIONSTORE": true, "SINTERSTORE": true, "SDIFFSTORE": true,
+	"ZADD": true, "ZINCRBY": true, "ZUNIONSTORE": true, "ZINTERSTORE": true, "ZDIFFSTORE": true, "ZRANGESTORE": true,
+	"XADD": true, "GEOADD": true, "GEOSEARCHSTORE": true, "PFADD": true, "PFMERGE": true, "SORT": true,
+}
+
+var (
+	unmaskedWarned    = make(map[string]bool)
+	unmaskedWarnedMux sync.Mutex
+)
+
+// warnUnmasked logs a warning, once for each command, when e writes values that
+// can not be masked to a key matched by a mask.
+func warnUnmasked(e *entry.Entry) {
+	if !unmaskedCommands[e.CmdName] || !slices.ContainsFunc(e.Keys, matchMasks) {
+		return
+	}
+	unmaskedWarnedMux.Lock()
+	defer unmaskedWarnedMux.Unlock()
+	if unmaskedWarned[e.CmdName] {
+		return
+	}
+	unmaskedWarned[e.CmdName] = true
+	log.Warnf("the values written by %s can not be masked and are written as is, further %s commands are not reported. keys=%v", e.CmdName, e.CmdName, e.Keys)
+}
+
+// maskEntry masks the values written by the string and hash commands of e:
+//
+//	SET, SETNX, GETSET, APPEND key value, SETEX, PSETEX key ttl value
+//	MSET, MSETNX key value [key value ...]
+//	HSET, HMSET key field value [field value ...], HSETNX key field value
+//
+// Each value is masked by the first matching mask only. Other commands writing
+// values to a masked key are reported by warnUnmasked.
+func maskEntry(e *entry.Entry) {
+	maskAt := func(keyInx, fieldInx, valueInx int) {
+		if valueInx >= len(e.Argv) {
+			return
+		}
+		field := ""
+		if fieldInx != -1 {
+			field = e.Argv[fieldInx]
+		}
+		for inx := range masks {
+			m := &masks[inx]
+			if m.matchKey(e.Argv[keyInx]) && m.matchField(fieldInx != -1, field) {
+				e.Argv[valueInx] = m.maskValue(e.Argv[valueInx])
+				return
+			}
+		}
+	}
+	switch e.CmdName {
+	case "SET", "SETNX", "GETSET", "APPEND":
+		maskAt(1, -1, 2)
+	case "SETEX", "PSETEX":
+		maskAt(1, -1, 3)
+	case "MSET", "MSETNX":
+		for inx := 1; inx+1 < len(e.Argv); inx += 2 {
+			maskAt(inx, -1, inx+1)
+		}
+	case "HSET", "HMSET", "HSETNX":
+		for inx := 2; inx+1 < len(e.Argv); inx += 2 {
+			maskAt(1, inx, inx+1)
+		}
+	default:
+		warnUnmasked(e)
+	}
+}
+
+func (m *mask) matchKey(key string) bool {
+	return m.keyRegex == nil || m.keyRegex.MatchString(key)
+}
+
+// matchField reports whether m applies to a hash field, or to a string value
+// if isField is false. A mask without fields applies to string values only.
+func (m *mask) matchField(isField bool, field string) bool {
+	if !isField {
+		return len(m.Fields) == 0
+	}
+	return slices.Contains(m.Fields, field)
+}
+
+// maskValue masks the parts of value matching value_regex, or the whole value.
+func (m *mask) maskValue(value string) string {
+	if m.valueRegex != nil {
+		return m.valueRegex.ReplaceAllStringFunc(value, m.mask)
+	}
+	return m.mask(value)
+}
+
+// mask masks s with the method of m. hash and fake are deterministic, so the
+// same value is masked the same way in every key.
+func (m *mask) mask(s string) string {
+	switch m.Method {
+	case "hash":
+		return hex.EncodeToString(m.sum(s))[:16]
+	case "redact":
+		return strings.Repeat("*", utf8.RuneCountInString(s))
+	default:
+		return fakeValue(s, int64(binary.BigEndian.Uint64(m.sum(s))))
+	}
+}
+
+func (m *mask) sum(s string) []byte {
+	mac := hmac.New(sha256.New, []byte(m.Salt))
+	mac.Write([]byte(s))
+	return mac.Sum(nil)
+}
+
+// fakeValue replaces the digits and letters of s by random ones of the same
+// kind, keeping the other characters, so that the format of emails, phone
+// numbers or card numbers is preserved.
+func fakeValue(s string, seed int64) string {
+	r := rand.New(rand.NewSource(seed))
+	return strings.Map(func(c rune) rune {
+		switch {
+		case c >= '0' && c <= '9':
+			return '0' + rune(r.Intn(10))
+		case c >= 'a' && c <= 'z':
+			return 'a' + rune(r.Intn(26))
+		case c >= 'A' && c <= 'Z':
+			return 'A' + rune(r.Intn(26))
+		}
+		return c
+	}, s)
+}
@@ -0,0 +1,69 @@
+package transform
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+)
+
+func TestMask(t *testing.T) {
+	config.Opt = config.ShakeOptions{
+		Transform: config.TransformOptions{
+			TTLMultiply: 1,
+			Rules:       []config.TransformRule{{KeyRegex: "^legacy:(.*)$", RenameKey: "user:$1"}},
+			Masks: []config.MaskRule{
+				{KeyRegex: "^user:", Fields: []string{"email"}, Method: "fake"},
+				{KeyRegex: "^user:", Fields: []string{"phone"}, Method: "redact"},
+				{KeyRegex: "^card:", Method: "hash", Salt: "salt"},
+				{KeyRegex: "^log:", ValueRegex: `\d{4}-\d{4}`, Method: "redact"},
+			},
+		},
+	}
+	Init()
+	transform := func(argv ...string) []string {
+		e := entry.NewEntry()
+		e.Argv = argv
+		e.Parse()
+		return Transform(e)[0].Argv
+	}
+
+	argv := transform("HSET", "user:1", "email", "Alice.B@example.com", "phone", "+1 555", "name", "alice")
+	if !regexp.MustCompile(`^[A-Z][a-z]{4}\.[A-Z]@[a-z]{7}\.[a-z]{3}$`).MatchString(argv[3]) || argv[3] == "Alice.B@example.com" {
+		t.Errorf("email should be faked with the same format, got %s", argv[3])
+	}
+	if argv[5] != "******" || argv[7] != "alice" {
+		t.Errorf("unexpected masked hash. argv=%v", argv)
+	}
+	if again := transform("HMSET", "user:2", "email", "Alice.B@example.com"); again[3] != argv[3] {
+		t.Errorf("fake should be deterministic, got %s and %s", again[3], argv[3])
+	}
+
+	hashed := transform("SET", "card:1", "4111111111111111", "EX", "10")
+	if len(hashed[2]) != 16 || hashed[2] == "4111111111111111" || hashed[4] != "10" {
+		t.Errorf("unexpected hashed value. argv=%v", hashed)
+	}
+	if mset := transform("MSET", "card:2", "4111111111111111", "other", "4111111111111111"); mset[2] != hashed[2] || mset[4] != "4111111111111111" {
+		t.Errorf("unexpected masked MSET. argv=%v", mset)
+	}
+	if got := strings.Join(transform("SETEX", "log:1", "10", "card 1234-5678 used"), " "); got != "SETEX log:1 10 card ********* used" {
+		t.Errorf("unexpected masked SETEX. got %s", got)
+	}
+	if got := strings.Join(transform("HSET", "card:1", "number", "1"), " "); got != "HSET card:1 number 1" {
+		t.Errorf("a mask without fields should not mask hash fields, got %s", got)
+	}
+	if !MasksKey("user:1") || !MasksKey("legacy:1") || MasksKey("other") {
+		t.Errorf("unexpected MasksKey")
+	}
+	if got := strings.Join(transform("HSET", "legacy:1", "phone", "+1 555"), " "); got != "HSET user:1 phone ******" {
+		t.Errorf("masks should see the renamed key, got %s", got)
+	}
+
+	transform("RPUSH", "card:1", "4111111111111111")
+	transform("LPUSH", "other", "4111111111111111")
+	if !unmaskedWarned["RPUSH"] || unmaskedWarned["LPUSH"] {
+		t.Errorf("unexpected warnings of unmasked commands: %v", unmaskedWarned)
+	}
+}
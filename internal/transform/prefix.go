@@ -0,0 +1,57 @@
+package transform
+
+import (
+	"strings"
+
+	"RedisShake/internal/commands"
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+)
+
+// renameKeyPrefix strips strip_key_prefix, then replaces the first matching
+// prefix of key_prefix_map, then prepends add_key_prefix.
+func renameKeyPrefix(key string) string {
+	opts := &config.Opt.Transform
+	if opts.StripKeyPrefix != "" {
+		key = strings.TrimPrefix(key, opts.StripKeyPrefix)
+	}
+	for _, mapping := range opts.KeyPrefixMap {
+		if strings.HasPrefix(key, mapping.From) {
+			key = mapping.To + key[len(mapping.From):]
+			break
+		}
+	}
+	return opts.AddKeyPrefix + key
+}
+
+// renameSortKeys handles SORT and SORT_RO, which are not described by key
+// specs. The BY and GET patterns refer to other keys, so they are renamed as
+// well, except for the special "nosort" and "#" patterns.
+//
+//	SORT key [BY pattern] [LIMIT offset count] [GET pattern ...] [ASC|DESC] [ALPHA] [STORE destination]
+func renameSortKeys(e *entry.Entry, rename func(key string) string) {
+	if len(e.Argv) < 2 {
+		return
+	}
+	e.Argv[1] = rename(e.Argv[1])
+	e.Keys = []string{e.Argv[1]}
+	e.KeyIndexes = []int{2}
+	for inx := 2; inx+1 < len(e.Argv); inx++ {
+		switch strings.ToUpper(e.Argv[inx]) {
+		case "BY", "GET":
+			pattern := e.Argv[inx+1]
+			if pattern != "#" && !strings.EqualFold(pattern, "nosort") {
+				e.Argv[inx+1] = rename(pattern)
+			}
+			inx++
+		case "LIMIT":
+			inx += 2
+		case "STORE":
+			e.Argv[inx+1] = rename(e.Argv[inx+1])
+			e.Keys = append(e.Keys, e.Argv[inx+1])
+			e.KeyIndexes = append(e.KeyIndexes, inx+2)
+			inx++
+		}
+	}
+	e.Slots = commands.CalcSlots(e.Keys)
+}
@@ -0,0 +1,60 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+
+	"RedisShake/internal/commands"
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+)
+
+func TestKeyPrefix(t *testing.T) {
+	config.Opt = config.ShakeOptions{
+		Transform: config.TransformOptions{
+			TTLMultiply:    1,
+			AddKeyPrefix:   "new:",
+			StripKeyPrefix: "old:",
+			KeyPrefixMap:   []config.KeyPrefixMapping{{From: "tenant1:", To: "t1:"}},
+		},
+	}
+	Init()
+	cases := []struct {
+		argv string
+		want string
+	}{
+		{"SET old:key value", "SET new:key value"},
+		{"SET tenant1:key old:key", "SET new:t1:key old:key"},
+		{"MSET old:a old:1 b 2", "MSET new:a old:1 new:b 2"},
+		{"DEL a b c", "DEL new:a new:b new:c"},
+		{"RENAME a b", "RENAME new:a new:b"},
+		{"ZUNIONSTORE dst 2 a b WEIGHTS 1 2", "ZUNIONSTORE new:dst 2 new:a new:b WEIGHTS 1 2"},
+		{"EVAL script 2 a b a b", "EVAL script 2 new:a new:b a b"},
+		{"BITOP AND dst a b", "BITOP AND new:dst new:a new:b"},
+		{"XGROUP CREATE stream group $", "XGROUP CREATE new:stream group $"},
+		{"XREADGROUP GROUP g c STREAMS a b 0 0", "XREADGROUP GROUP g c STREAMS new:a new:b 0 0"},
+		{"GEORADIUS a 0 0 1 km STORE dst", "GEORADIUS new:a 0 0 1 km STORE new:dst"},
+		{"SORT list BY weight_* GET # GET old:obj_* LIMIT 0 10 STORE dst", "SORT new:list BY new:weight_* GET # GET new:obj_* LIMIT 0 10 STORE new:dst"},
+		{"SORT list BY nosort", "SORT new:list BY nosort"},
+		{"PING", "PING"},
+	}
+	for _, c := range cases {
+		e := entry.NewEntry()
+		e.Argv = strings.Split(c.argv, " ")
+		e.Parse()
+		entries := Transform(e)
+		if len(entries) != 1 {
+			t.Fatalf("Transform(%s) returned %d entries", c.argv, len(entries))
+		}
+		got := strings.Join(entries[0].Argv, " ")
+		if got != c.want {
+			t.Errorf("Transform(%s) = %s, want %s", c.argv, got, c.want)
+		}
+		slots := commands.CalcSlots(entries[0].Keys)
+		for inx := range slots {
+			if slots[inx] != entries[0].Slots[inx] {
+				t.Errorf("Transform(%s) slots not updated. slots=%v", c.argv, entries[0].Slots)
+			}
+		}
+	}
+}
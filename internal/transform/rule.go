@@ -0,0 +1,138 @@
+package transform
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"RedisShake/internal/commands"
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+	"RedisShake/internal/log"
+)
+
+type rule struct {
+	*config.TransformRule
+	keyRegex *regexp.Regexp
+}
+
+var rules []rule
+
+func initRules() {
+	rules = nil
+	for inx := range config.Opt.Transform.Rules {
+		r := rule{TransformRule: &config.Opt.Transform.Rules[inx]}
+		if r.KeyRegex != "" {
+			re, err := regexp.Compile(r.KeyRegex)
+			if err != nil {
+				log.Panicf("invalid key_regex of transform rule %d. key_regex=[%s], error=[%v]", inx+1, r.KeyRegex, err)
+			}
+			r.keyRegex = re
+		}
+		if r.RenameKey != "" && r.keyRegex == nil {
+			log.Panicf("rename_key of transform rule %d requires key_regex", inx+1)
+		}
+		if r.SetTTL < 0 || r.MaxTTL < 0 || (r.ToDb != nil && *r.ToDb < 0) {
+			log.Panicf("set_ttl, max_ttl and to_db of transform rule %d can not be negative", inx+1)
+		}
+		if len(r.RemoveArgs) > 0 {
+			validateRemoveArgs(inx, r.TransformRule)
+		}
+		if r.StripTTL && (r.SetTTL != 0 || r.MaxTTL != 0) {
+			log.Panicf("strip_ttl of transform rule %d can not be used with set_ttl or max_ttl", inx+1)
+		}
+		rules = append(rules, r)
+	}
+	if len(rules) > 0 {
+		log.Infof("transform rules. count=[%d]", len(rules))
+	}
+}
+
+// applyRules applies the actions of every matching rule to e in order. It
+// returns false if e should be dropped.
+func applyRules(e *entry.Entry) bool {
+	for inx := range rules {
+		r := &rules[inx]
+		if !r.match(e) {
+			continue
+		}
+		if r.Drop {
+			log.Debugf("transform rule %d drops the entry. cmd=[%s]", inx+1, e.String())
+			return false
+		}
+		r.apply(e)
+	}
+	return true
+}
+
+func (r *rule) match(e *entry.Entry) bool {
+	equalFold := func(s string) func(string) bool {
+		return func(t string) bool { return strings.EqualFold(s, t) }
+	}
+	if len(r.Command) > 0 && !slices.ContainsFunc(r.Command, equalFold(e.CmdName)) {
+		return false
+	}
+	if len(r.Group) > 0 && !slices.ContainsFunc(r.Group, equalFold(e.Group)) {
+		return false
+	}
+	if len(r.Db) > 0 && !slices.Contains(r.Db, e.DbId) {
+		return false
+	}
+	if r.keyRegex != nil && !slices.ContainsFunc(e.Keys, r.keyRegex.MatchString) {
+		return false
+	}
+	return true
+}
+
+func (r *rule) apply(e *entry.Entry) {
+	if r.RenameCommand != "" {
+		e.Argv[0] = r.RenameCommand
+		e.Parse()
+	}
+	if len(r.RemoveArgs) > 0 {
+		removeArgs(e, r.RemoveArgs)
+	}
+	if r.RenameKey != "" {
+		renameKeys(e, func(key string) string {
+			return r.keyRegex.ReplaceAllString(key, r.RenameKey)
+		})
+	}
+	if ttl, ok := getTTL(e); ok {
+		switch {
+		case r.StripTTL && ttl != -1:
+			setTTL(e, -1)
+		case r.SetTTL > 0:
+			setTTL(e, r.SetTTL*1000)
+		case r.MaxTTL > 0 && (ttl == -1 || ttl > r.MaxTTL*1000):
+			setTTL(e, r.MaxTTL*1000)
+		}
+	}
+	if r.ToDb != nil {
+		e.DbId = *r.ToDb
+	}
+}
+
+// validateRemoveArgs checks that each of remove_args is an option of one of the
+// commands of the rule. Other commands matching the rule are left unchanged.
+func validateRemoveArgs(inx int, r *config.TransformRule) {
+	cmds := r.Command
+	if r.RenameCommand != "" {
+		cmds = []string{r.RenameCommand}
+	}
+	if len(cmds) == 0 {
+		log.Panicf("remove_args of transform rule %d requires command", inx+1)
+	}
+	for _, arg := range r.RemoveArgs {
+		if !slices.ContainsFunc(cmds, func(cmd string) bool { return commands.HasOption(cmd, arg) }) {
+			log.Panicf("remove_args of transform rule %d: %s is not an option of %v", inx+1, arg, cmds)
+		}
+	}
+}
+
+// removeArgs removes the options of e in args, ignoring case, together with
+// their arguments, e.g. EX and its seconds from SET. Keys and values are never
+// removed.
+func removeArgs(e *entry.Entry, args []string) {
+	e.Argv = commands.RemoveOptions(e.Argv, args)
+	e.Parse()
+}
@@ -0,0 +1,53 @@
+package transform
+
+import (
+	"testing"
+
+	"RedisShake/internal/config"
+)
+
+func TestRules(t *testing.T) {
+	db := 3
+	config.Opt = config.ShakeOptions{
+		Transform: config.TransformOptions{
+			TTLMultiply: 1,
+			Rules: []config.TransformRule{
+				{Command: []string{"hmset"}, Group: []string{"hash"}, RenameCommand: "HSET"},
+				{Command: []string{"SET"}, RemoveArgs: []string{"GET"}},
+				{Command: []string{"SET", "ZADD", "XADD"}, KeyRegex: "^plain:", RemoveArgs: []string{"EX", "GT", "MAXLEN"}},
+				{KeyRegex: `^user:(\d+)$`, RenameKey: "member:$1"},
+				{KeyRegex: "^session:", MaxTTL: 60},
+				{KeyRegex: "^cache:", StripTTL: true},
+				{KeyRegex: "^fixed:", SetTTL: 10},
+				{Db: []int{1}, ToDb: &db},
+				{Command: []string{"FLUSHALL"}, Drop: true},
+			},
+		},
+	}
+	Init()
+	testTransformDb(t, 0, "HMSET h f v", 0, "HSET h f v")
+	testTransformDb(t, 0, "SET a v GET", 0, "SET a v")
+	testTransformDb(t, 0, "SET a GET", 0, "SET a GET")
+	testTransformDb(t, 0, "SET plain:1 v EX 10 NX", 0, "SET plain:1 v NX")
+	testTransformDb(t, 0, "SET plain:1 EX EX 10", 0, "SET plain:1 EX")
+	testTransformDb(t, 0, "ZADD plain:z GT CH 1 GT", 0, "ZADD plain:z CH 1 GT")
+	testTransformDb(t, 0, "XADD plain:s MAXLEN ~ 100 * f v", 0, "XADD plain:s * f v")
+	testTransformDb(t, 0, "XADD plain:s NOMKSTREAM MAXLEN 100 * MAXLEN v", 0, "XADD plain:s NOMKSTREAM * MAXLEN v")
+	testTransformDb(t, 0, "DEL user:1 user:x user:22", 0, "DEL member:1 user:x member:22")
+	testTransformDb(t, 0, "SET session:1 v", 0, "SET session:1 v PX 60000")
+	testTransformDb(t, 0, "SET session:1 v EX 10 NX", 0, "SET session:1 v EX 10 NX")
+	testTransformDb(t, 0, "SET session:1 v NX EX 100", 0, "SET session:1 v NX PX 60000")
+	testTransformDb(t, 0, "SET session:1 v KEEPTTL", 0, "SET session:1 v KEEPTTL")
+	testTransformDb(t, 0, "SETEX session:1 100 v", 0, "PSETEX session:1 60000 v")
+	testTransformDb(t, 0, "EXPIRE session:1 100", 0, "PEXPIRE session:1 60000")
+	testTransformDb(t, 0, "EXPIRE session:1 -1", 0, "EXPIRE session:1 -1")
+	testTransformDb(t, 0, "EXPIRE cache:1 100", 0, "PERSIST cache:1")
+	testTransformDb(t, 0, "SETEX cache:1 100 v", 0, "SET cache:1 v")
+	testTransformDb(t, 0, "SET cache:1 v PX 100 XX", 0, "SET cache:1 v XX")
+	testTransformDb(t, 0, "GETEX cache:1 EX 100", 0, "GETEX cache:1 PERSIST")
+	testTransformDb(t, 0, "RESTORE cache:1 100 payload REPLACE", 0, "RESTORE cache:1 0 payload REPLACE")
+	testTransformDb(t, 0, "RESTORE fixed:1 0 payload", 0, "RESTORE fixed:1 10000 payload")
+	testTransformDb(t, 0, "GETEX fixed:1 PERSIST", 0, "GETEX fixed:1 PX 10000")
+	testTransformDb(t, 1, "SET a 1", 3, "SET a 1")
+	testTransformDb(t, 0, "FLUSHALL", 0, "")
+}
@@ -0,0 +1,68 @@
+package transform
+
+import (
+	"RedisShake/internal/commands"
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+)
+
+// Init validates and prepares the [transform] options, it must be called
+// once after the config is loaded.
+func Init() {
+	initRules()
+	initMasks()
+	initTTLPolicy()
+	initDbMap()
+}
+
+// Transform applies the built-in [transform] options to an entry that passed
+// filter.Filter. It returns the entries to be written, which may be empty if
+// the entry should be dropped. The rules apply first, so the masks, the TTL
+// policy, the key prefix options and db_map see the result of the rules.
+func Transform(e *entry.Entry) []*entry.Entry {
+	opts := &config.Opt.Transform
+	if len(rules) > 0 && !applyRules(e) {
+		return []*entry.Entry{}
+	}
+	if len(masks) > 0 {
+		maskEntry(e)
+	}
+	if ttlPolicyEnabled && e.Phase != entry.PhaseRDB {
+		if ttl, ok := getTTL(e); ok {
+			if newTTL := ApplyTTLPolicy(ttl); newTTL != ttl {
+				setTTL(e, newTTL)
+			}
+		}
+	}
+	if opts.AddKeyPrefix != "" || opts.StripKeyPrefix != "" || len(opts.KeyPrefixMap) > 0 {
+		renameKeys(e, renameKeyPrefix)
+	}
+	if len(dbMap) > 0 || opts.MergeDb {
+		if !transformDb(e) {
+			return []*entry.Entry{}
+		}
+	}
+	return []*entry.Entry{e}
+}
+
+// renameKeys replaces every key of e by rename(key), both in Keys and at the
+// matching KeyIndexes position of Argv, and recomputes Slots.
+func renameKeys(e *entry.Entry, rename func(key string) string) {
+	if e.CmdName == "SORT" || e.CmdName == "SORT_RO" {
+		renameSortKeys(e, rename)
+		return
+	}
+	changed := false
+	for inx, key := range e.Keys {
+		newKey := rename(key)
+		if newKey == key {
+			continue
+		}
+		e.Keys[inx] = newKey
+		e.Argv[e.KeyIndexes[inx]-1] = newKey // KeyIndexes start from 1
+		changed = true
+	}
+	if changed {
+		e.Slots = commands.CalcSlots(e.Keys)
+	}
+}
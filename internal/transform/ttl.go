@@ -0,0 +1,231 @@
+package transform
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+	"RedisShake/internal/log"
+)
+
+// ttlOption is the position of a TTL in a command. abs is set if the TTL is a
+// unix time, ms if it is in milliseconds.
+type ttlOption struct {
+	inx int // index of the value in Argv, -1 if the command sets no TTL
+	abs bool
+	ms  bool
+}
+
+// findTTL locates the TTL of the commands that set one:
+//
+//	EXPIRE key seconds, PEXPIRE key milliseconds, EXPIREAT, PEXPIREAT
+//	SETEX key seconds value, PSETEX key milliseconds value
+//	SET key value [EX|PX|EXAT|PXAT ttl], GETEX key [EX|PX|EXAT|PXAT ttl|PERSIST]
+//	RESTORE key ttl value [ABSTTL]
+//	PERSIST key
+//
+// ok is false for other commands, and for SET KEEPTTL and GETEX without
+// option, whose TTL is unknown.
+func findTTL(e *entry.Entry) (opt ttlOption, ok bool) {
+	if len(e.Argv) < 2 || (len(e.Argv) < 3 && e.CmdName != "GETEX" && e.CmdName != "PERSIST") {
+		return opt, false
+	}
+	switch e.CmdName {
+	case "PERSIST":
+		return ttlOption{inx: -1}, len(e.Argv) == 2
+	case "EXPIRE":
+		return ttlOption{inx: 2}, true
+	case "PEXPIRE":
+		return ttlOption{inx: 2, ms: true}, true
+	case "EXPIREAT":
+		return ttlOption{inx: 2, abs: true}, true
+	case "PEXPIREAT":
+		return ttlOption{inx: 2, abs: true, ms: true}, true
+	case "SETEX":
+		return ttlOption{inx: 2}, len(e.Argv) == 4
+	case "PSETEX":
+		return ttlOption{inx: 2, ms: true}, len(e.Argv) == 4
+	case "RESTORE":
+		if len(e.Argv) < 4 {
+			return opt, false
+		}
+		for _, arg := range e.Argv[4:] {
+			if strings.EqualFold(arg, "ABSTTL") {
+				return ttlOption{inx: 2, abs: true, ms: true}, true
+			}
+		}
+		return ttlOption{inx: 2, ms: true}, true
+	case "SET", "GETEX":
+		start := 3
+		if e.CmdName == "GETEX" {
+			start = 2
+		}
+		for inx := start; inx < len(e.Argv); inx++ {
+			switch strings.ToUpper(e.Argv[inx]) {
+			case "EX":
+				return ttlOption{inx: inx + 1}, inx+1 < len(e.Argv)
+			case "PX":
+				return ttlOption{inx: inx + 1, ms: true}, inx+1 < len(e.Argv)
+			case "EXAT":
+				return ttlOption{inx: inx + 1, abs: true}, inx+1 < len(e.Argv)
+			case "PXAT":
+				return ttlOption{inx: inx + 1, abs: true, ms: true}, inx+1 < len(e.Argv)
+			case "KEEPTTL":
+				return opt, false
+			case "PERSIST":
+				return ttlOption{inx: -1}, true
+			}
+		}
+		return ttlOption{inx: -1}, e.CmdName == "SET"
+	}
+	return opt, false
+}
+
+// getTTL returns the TTL in milliseconds set by e, -1 if e removes the TTL. ok
+// is false if e does not set a TTL, or deletes the key with a TTL that is not
+// positive, which should be left as is.
+func getTTL(e *entry.Entry) (ttlMs int64, ok bool) {
+	opt, ok := findTTL(e)
+	if !ok {
+		return 0, false
+	}
+	if opt.inx == -1 {
+		return -1, true
+	}
+	ttl, err := strconv.ParseInt(e.Argv[opt.inx], 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if e.CmdName == "RESTORE" && ttl == 0 {
+		return -1, true
+	}
+	if !opt.ms {
+		ttl *= 1000
+	}
+	if opt.abs {
+		ttl -= time.Now().UnixMilli()
+	}
+	return ttl, ttl > 0
+}
+
+// setTTL changes the TTL set by e to ttlMs, -1 removes the TTL. e must be a
+// command accepted by getTTL. Relative TTLs are rewritten in milliseconds and
+// absolute ones as a unix time in milliseconds, e.g. EXPIRE becomes PEXPIRE.
+func setTTL(e *entry.Entry, ttlMs int64) {
+	opt, _ := findTTL(e)
+	value := ttlMs
+	if opt.abs && ttlMs != -1 {
+		value += time.Now().UnixMilli()
+	}
+	switch e.CmdName {
+	case "PERSIST":
+		if ttlMs != -1 {
+			e.Argv = []string{"PEXPIRE", e.Argv[1], ""}
+			opt.inx = 2
+		}
+	case "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT":
+		if ttlMs == -1 {
+			e.Argv = []string{"PERSIST", e.Argv[1]}
+		} else if opt.abs {
+			e.Argv[0] = "PEXPIREAT"
+		} else {
+			e.Argv[0] = "PEXPIRE"
+		}
+	case "SETEX", "PSETEX":
+		if ttlMs == -1 {
+			e.Argv = []string{"SET", e.Argv[1], e.Argv[3]}
+		} else {
+			e.Argv[0] = "PSETEX"
+		}
+	case "RESTORE":
+		if ttlMs == -1 {
+			value = 0
+		}
+	case "SET", "GETEX":
+		// drop the previous TTL option, then append the new one
+		argv := make([]string, 0, len(e.Argv)+2)
+		for inx, arg := range e.Argv {
+			if opt.inx != -1 && (inx == opt.inx-1 || inx == opt.inx) {
+				continue
+			}
+			if e.CmdName == "GETEX" && inx >= 2 && strings.EqualFold(arg, "PERSIST") {
+				continue
+			}
+			argv = append(argv, arg)
+		}
+		switch {
+		case ttlMs == -1 && e.CmdName == "GETEX":
+			argv = append(argv, "PERSIST")
+		case ttlMs == -1:
+		case opt.abs:
+			argv = append(argv, "PXAT")
+		default:
+			argv = append(argv, "PX")
+		}
+		if ttlMs != -1 {
+			argv = append(argv, "")
+		}
+		e.Argv = argv
+		opt.inx = len(argv) - 1
+	}
+	if ttlMs != -1 || e.CmdName == "RESTORE" {
+		e.Argv[opt.inx] = strconv.FormatInt(value, 10)
+	}
+	e.Parse()
+}
+
+var ttlPolicyEnabled bool
+
+func initTTLPolicy() {
+	opts := &config.Opt.Transform
+	if opts.TTLMultiply <= 0 || opts.TTLMin < 0 || opts.TTLMax < 0 || opts.TTLJitter < 0 {
+		log.Panicf("ttl_multiply must be positive, ttl_min, ttl_max and ttl_jitter can not be negative. ttl_multiply=[%v], ttl_min=[%d], ttl_max=[%d], ttl_jitter=[%d]",
+			opts.TTLMultiply, opts.TTLMin, opts.TTLMax, opts.TTLJitter)
+	}
+	if opts.TTLMax != 0 && opts.TTLMin > opts.TTLMax {
+		log.Panicf("ttl_min can not be greater than ttl_max. ttl_min=[%d], ttl_max=[%d]", opts.TTLMin, opts.TTLMax)
+	}
+	ttlPolicyEnabled = opts.TTLStrip || opts.TTLMultiply != 1 || opts.TTLMin != 0 || opts.TTLMax != 0 || opts.TTLJitter != 0
+	if ttlPolicyEnabled {
+		log.Infof("transform ttl. ttl_strip=[%v], ttl_multiply=[%v], ttl_min=[%d], ttl_max=[%d], ttl_jitter=[%d]",
+			opts.TTLStrip, opts.TTLMultiply, opts.TTLMin, opts.TTLMax, opts.TTLJitter)
+	}
+}
+
+// ApplyTTLPolicy returns the TTL in milliseconds of a key whose source TTL is
+// ttlMs, -1 means no TTL. The TTL is multiplied, raised to ttl_min, capped to
+// ttl_max, then reduced by a random jitter so that keys capped together do
+// not expire together, though never below ttl_min. A key without TTL gets
+// ttl_max if it is set.
+//
+// The snapshot readers apply it to the TTL of each key, Transform applies it
+// to the commands of the incremental phase.
+func ApplyTTLPolicy(ttlMs int64) int64 {
+	if !ttlPolicyEnabled {
+		return ttlMs
+	}
+	opts := &config.Opt.Transform
+	if opts.TTLStrip {
+		return -1
+	}
+	if ttlMs == -1 {
+		if opts.TTLMax == 0 {
+			return -1
+		}
+		ttlMs = opts.TTLMax * 1000
+	} else {
+		ttlMs = int64(float64(ttlMs) * opts.TTLMultiply)
+		ttlMs = max(ttlMs, opts.TTLMin*1000)
+		if opts.TTLMax != 0 {
+			ttlMs = min(ttlMs, opts.TTLMax*1000)
+		}
+	}
+	if opts.TTLJitter != 0 {
+		ttlMs -= rand.Int63n(opts.TTLJitter * 1000)
+		ttlMs = max(ttlMs, opts.TTLMin*1000)
+	}
+	return max(ttlMs, 1)
+}
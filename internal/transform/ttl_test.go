@@ -0,0 +1,72 @@
+package transform
+
+import (
+	"strings"
+	"testing"
+
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+)
+
+func TestTTLPolicy(t *testing.T) {
+	config.Opt = config.ShakeOptions{
+		Transform: config.TransformOptions{
+			TTLMultiply: 2,
+			TTLMin:      60,
+			TTLMax:      3600,
+		},
+	}
+	Init()
+	cases := []struct {
+		ttl  int64
+		want int64
+	}{
+		{-1, 3600000},
+		{10000, 60000},
+		{100000, 200000},
+		{3000000, 3600000},
+	}
+	for _, c := range cases {
+		if got := ApplyTTLPolicy(c.ttl); got != c.want {
+			t.Errorf("ApplyTTLPolicy(%d) = %d, want %d", c.ttl, got, c.want)
+		}
+	}
+	testTransformDb(t, 0, "SET a 1", 0, "SET a 1 PX 3600000")
+	testTransformDb(t, 0, "SET a 1 EX 100", 0, "SET a 1 PX 200000")
+	testTransformDb(t, 0, "EXPIRE a 10", 0, "PEXPIRE a 60000")
+	testTransformDb(t, 0, "PERSIST a", 0, "PEXPIRE a 3600000")
+	testTransformDb(t, 0, "RESTORE a 0 payload", 0, "RESTORE a 3600000 payload")
+	testTransformDb(t, 0, "HSET h f v", 0, "HSET h f v")
+
+	// the snapshot readers apply the policy to each key
+	e := entry.NewEntry()
+	e.Argv = []string{"PEXPIRE", "a", "10"}
+	e.Phase = entry.PhaseRDB
+	e.Parse()
+	if got := strings.Join(Transform(e)[0].Argv, " "); got != "PEXPIRE a 10" {
+		t.Errorf("Transform should not change the TTL of the snapshot phase, got %s", got)
+	}
+
+	config.Opt.Transform = config.TransformOptions{TTLMultiply: 1, TTLMax: 100, TTLJitter: 10}
+	Init()
+	for i := 0; i < 100; i++ {
+		if got := ApplyTTLPolicy(-1); got <= 90000 || got > 100000 {
+			t.Fatalf("ApplyTTLPolicy(-1) = %d, want (90000, 100000]", got)
+		}
+	}
+	config.Opt.Transform = config.TransformOptions{TTLMultiply: 1, TTLMin: 95, TTLMax: 100, TTLJitter: 10}
+	Init()
+	for i := 0; i < 100; i++ {
+		if got := ApplyTTLPolicy(20000); got != 95000 {
+			t.Fatalf("ApplyTTLPolicy(20000) = %d, want 95000", got)
+		}
+		if got := ApplyTTLPolicy(-1); got < 95000 || got > 100000 {
+			t.Fatalf("ApplyTTLPolicy(-1) = %d, want [95000, 100000]", got)
+		}
+	}
+
+	config.Opt.Transform = config.TransformOptions{TTLMultiply: 1, TTLStrip: true}
+	Init()
+	testTransformDb(t, 0, "SETEX a 10 v", 0, "SET a v")
+	testTransformDb(t, 0, "GETEX a PXAT 99999999999999", 0, "GETEX a PERSIST")
+}
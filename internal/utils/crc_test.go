@@ -1,6 +1,9 @@
 package utils
 
-import "testing"
+import (
+	"strings"
+	"testing"
+)
 
 func TestCrc16(t *testing.T) {
 	ret := Crc16("123456789")
@@ -8,3 +11,12 @@ func TestCrc16(t *testing.T) {
 		t.Errorf("Crc16(123456789) = %x", ret)
 	}
 }
+
+func TestSlotTag(t *testing.T) {
+	for slot := 0; slot < 16384; slot++ {
+		tag := SlotTag(slot)
+		if int(Crc16(tag)&0x3FFF) != slot || strings.ContainsAny(tag, "{}") {
+			t.Fatalf("SlotTag(%d) = %s", slot, tag)
+		}
+	}
+}
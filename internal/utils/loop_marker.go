@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"RedisShake/internal/config"
+)
+
+var (
+	slotTags     []string
+	slotTagsOnce sync.Once
+)
+
+// SlotTag returns a short string without braces that hashes to slot, so a key
+// containing "{" + SlotTag(slot) + "}" is always stored in slot.
+func SlotTag(slot int) string {
+	slotTagsOnce.Do(func() {
+		slotTags = make([]string, 16384)
+		found := 0
+		for i := int64(0); found < len(slotTags); i++ {
+			tag := strconv.FormatInt(i, 36)
+			s := Crc16(tag) & 0x3FFF
+			if slotTags[s] == "" {
+				slotTags[s] = tag
+				found++
+			}
+		}
+	})
+	return slotTags[slot]
+}
+
+// LoopMarkerKey returns the marker key written in front of every command in
+// bidirectional sync. It is stored in slot, so it can be written in the same
+// transaction as a command of that slot on a cluster.
+func LoopMarkerKey(slot int) string {
+	return config.Opt.Advanced.BidirectionalMarker + "{" + SlotTag(slot) + "}"
+}
+
+// IsLoopMarkerKey reports whether key is a marker key of bidirectional sync.
+func IsLoopMarkerKey(key string) bool {
+	return config.Opt.Advanced.Bidirectional && strings.HasPrefix(key, config.Opt.Advanced.BidirectionalMarker)
+}
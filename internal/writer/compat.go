@@ -0,0 +1,412 @@
+package writer
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"RedisShake/internal/entry"
+)
+
+// Redis versions are encoded as major*10000 + minor*100 + patch, the same as
+// client.ParseRedisVersion.
+const (
+	redisVersion600 = 60000
+	redisVersion620 = 60200
+	redisVersion700 = 70000
+)
+
+// incompatibleCommands are write commands that have no equivalent on targets
+// older than the given version. Entries of these commands are skipped and
+// reported instead of being sent to the target.
+var incompatibleCommands = map[string]int{
+	"FCALL":                 redisVersion700,
+	"FUNCTION-DELETE":       redisVersion700,
+	"FUNCTION-FLUSH":        redisVersion700,
+	"FUNCTION-LOAD":         redisVersion700,
+	"FUNCTION-RESTORE":      redisVersion700,
+	"SPUBLISH":              redisVersion700,
+	"GEOSEARCHSTORE":        redisVersion620,
+	"XAUTOCLAIM":            redisVersion620,
+	"XGROUP-CREATECONSUMER": redisVersion620,
+	"ZDIFFSTORE":            redisVersion620,
+	"ZRANGESTORE":           redisVersion620,
+}
+
+// Lua scripts used to emulate newer commands. Scripts call
+// redis.replicate_commands() because they mix random commands (PTTL, DUMP)
+// with writes, which is rejected by targets older than 5.0 otherwise.
+const (
+	// KEYS: key; ARGV: SET arguments without KEEPTTL
+	scriptSetKeepTTL = `redis.replicate_commands()
+local ttl = redis.call('PTTL', KEYS[1])
+local ret = redis.call('SET', KEYS[1], unpack(ARGV))
+if ret and ttl > 0 then
+    redis.call('PEXPIRE', KEYS[1], ttl)
+end
+return ret`
+
+	// KEYS: source, destination; ARGV: LPOP|RPOP, LPUSH|RPUSH
+	scriptLMove = `local value = redis.call(ARGV[1], KEYS[1])
+if value then
+    redis.call(ARGV[2], KEYS[2], value)
+end
+return value`
+
+	// KEYS: keys; ARGV: LPOP|RPOP, count
+	scriptLMPop = `for _, key in ipairs(KEYS) do
+    if redis.call('LLEN', key) > 0 then
+        for i = 1, tonumber(ARGV[2]) do
+            redis.call(ARGV[1], key)
+        end
+        return key
+    end
+end
+return false`
+
+	// KEYS: keys; ARGV: ZPOPMIN|ZPOPMAX, count
+	scriptZMPop = `for _, key in ipairs(KEYS) do
+    if redis.call('ZCARD', key) > 0 then
+        redis.call(ARGV[1], key, ARGV[2])
+        return key
+    end
+end
+return false`
+
+	// KEYS: key; ARGV: relative ttl in milliseconds, NX|XX|GT|LT...
+	scriptExpireWithOptions = `redis.replicate_commands()
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl == -2 then
+    return 0
+end
+local new = tonumber(ARGV[1])
+for i = 2, #ARGV do
+    local opt = string.upper(ARGV[i])
+    if opt == 'NX' and ttl ~= -1 then return 0 end
+    if opt == 'XX' and ttl == -1 then return 0 end
+    if opt == 'GT' and (ttl == -1 or new <= ttl) then return 0 end
+    if opt == 'LT' and ttl ~= -1 and new >= ttl then return 0 end
+end
+return redis.call('PEXPIRE', KEYS[1], ARGV[1])`
+
+	// KEYS: key; ARGV: XADD arguments without NOMKSTREAM
+	scriptXAddNoMkStream = `if redis.call('EXISTS', KEYS[1]) == 0 then
+    return false
+end
+return redis.call('XADD', KEYS[1], unpack(ARGV))`
+
+	// KEYS: source, destination; ARGV: REPLACE or "", destination db or ""
+	scriptCopy = `redis.replicate_commands()
+local value = redis.call('DUMP', KEYS[1])
+if not value then
+    return 0
+end
+local ttl = redis.call('PTTL', KEYS[1])
+if ttl < 0 then
+    ttl = 0
+end
+if ARGV[2] ~= '' then
+    redis.call('SELECT', ARGV[2])
+end
+if ARGV[1] ~= 'REPLACE' and redis.call('EXISTS', KEYS[2]) == 1 then
+    return 0
+end
+redis.call('RESTORE', KEYS[2], ttl, value, 'REPLACE')
+return 1`
+)
+
+// downgradeEntry rewrites e into commands that a target running the given
+// version understands. It returns false if e can not be downgraded. The
+// returned slice may be empty if e has no effect on the target, such as a
+// GETEX without options.
+func downgradeEntry(e *entry.Entry, version int) ([]*entry.Entry, bool) {
+	if version == 0 || version >= redisVersion700 {
+		return []*entry.Entry{e}, true
+	}
+	if since, ok := incompatibleCommands[e.CmdName]; ok && version < since {
+		return nil, false
+	}
+	argv := e.Argv
+	switch e.CmdName {
+	case "SET":
+		if version >= redisVersion620 {
+			break
+		}
+		return downgradeSet(e, version)
+	case "GETDEL":
+		if version >= redisVersion620 {
+			break
+		}
+		return []*entry.Entry{newCompatEntry(e.DbId, "DEL", argv[1])}, true
+	case "GETEX":
+		if version >= redisVersion620 {
+			break
+		}
+		return downgradeGetEx(e)
+	case "LMOVE", "BLMOVE":
+		if version >= redisVersion620 || len(argv) < 5 {
+			break
+		}
+		from, to := strings.ToUpper(argv[3]), strings.ToUpper(argv[4])
+		if from == "RIGHT" && to == "LEFT" {
+			return []*entry.Entry{newCompatEntry(e.DbId, "RPOPLPUSH", argv[1], argv[2])}, true
+		}
+		return []*entry.Entry{newEvalEntry(e.DbId, scriptLMove, argv[1:3], from[:1]+"POP", to[:1]+"PUSH")}, true
+	case "LMPOP", "BLMPOP", "ZMPOP", "BZMPOP":
+		return downgradeMPop(e)
+	case "EXPIRE", "PEXPIRE", "EXPIREAT", "PEXPIREAT":
+		if len(argv) <= 3 {
+			break
+		}
+		return downgradeExpire(e)
+	case "COPY":
+		if version >= redisVersion620 {
+			break
+		}
+		replace, db := "", ""
+		for i := 3; i < len(argv); i++ {
+			switch strings.ToUpper(argv[i]) {
+			case "REPLACE":
+				replace = "REPLACE"
+			case "DB":
+				if i+1 >= len(argv) {
+					return nil, false
+				}
+				db = argv[i+1]
+				i++
+			}
+		}
+		return []*entry.Entry{newEvalEntry(e.DbId, scriptCopy, argv[1:3], replace, db)}, true
+	case "XSETID":
+		// XSETID key last-id [ENTRIESADDED entries-added] [MAXDELETEDID max-deleted-id]
+		if len(argv) <= 3 {
+			break
+		}
+		return []*entry.Entry{newCompatEntry(e.DbId, argv[:3]...)}, true
+	case "XGROUP-CREATE", "XGROUP-SETID":
+		// XGROUP CREATE key group id [MKSTREAM] [ENTRIESREAD entries-read]
+		newArgv := make([]string, 0, len(argv))
+		for i := 0; i < len(argv); i++ {
+			if i >= 5 && strings.EqualFold(argv[i], "ENTRIESREAD") {
+				i++
+				continue
+			}
+			newArgv = append(newArgv, argv[i])
+		}
+		return []*entry.Entry{newCompatEntry(e.DbId, newArgv...)}, true
+	case "XADD", "XTRIM":
+		if version >= redisVersion620 {
+			break
+		}
+		return downgradeXTrimOptions(e)
+	}
+	return []*entry.Entry{e}, true
+}
+
+// downgradeSet handles the GET, EXAT, PXAT and KEEPTTL options of SET.
+func downgradeSet(e *entry.Entry, version int) ([]*entry.Entry, bool) {
+	argv := e.Argv
+	if len(argv) <= 3 {
+		return []*entry.Entry{e}, true
+	}
+	newArgv := []string{argv[0], argv[1], argv[2]}
+	keepTTL := false
+	for i := 3; i < len(argv); i++ {
+		opt := strings.ToUpper(argv[i])
+		switch opt {
+		case "GET": // the old value is not used
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if i+1 >= len(argv) {
+				return nil, false
+			}
+			value, err := strconv.ParseInt(argv[i+1], 10, 64)
+			if err != nil {
+				return nil, false
+			}
+			i++
+			switch opt {
+			case "EXAT":
+				value = value*1000 - time.Now().UnixMilli()
+			case "PXAT":
+				value = value - time.Now().UnixMilli()
+			default:
+				newArgv = append(newArgv, opt, strconv.FormatInt(value, 10))
+				continue
+			}
+			if value <= 0 {
+				value = 1 // already expired, let the target expire it
+			}
+			newArgv = append(newArgv, "PX", strconv.FormatInt(value, 10))
+		default:
+			newArgv = append(newArgv, argv[i])
+		}
+	}
+	if keepTTL {
+		if version >= redisVersion600 {
+			newArgv = append(newArgv, "KEEPTTL")
+		} else {
+			return []*entry.Entry{newEvalEntry(e.DbId, scriptSetKeepTTL, newArgv[1:2], newArgv[2:]...)}, true
+		}
+	}
+	return []*entry.Entry{newCompatEntry(e.DbId, newArgv...)}, true
+}
+
+// downgradeGetEx converts GETEX key [EX|PX|EXAT|PXAT time|PERSIST].
+func downgradeGetEx(e *entry.Entry) ([]*entry.Entry, bool) {
+	argv := e.Argv
+	if len(argv) == 2 {
+		return []*entry.Entry{}, true // a plain read
+	}
+	switch strings.ToUpper(argv[2]) {
+	case "PERSIST":
+		return []*entry.Entry{newCompatEntry(e.DbId, "PERSIST", argv[1])}, true
+	case "EX":
+		if len(argv) < 4 {
+			return nil, false
+		}
+		return []*entry.Entry{newCompatEntry(e.DbId, "EXPIRE", argv[1], argv[3])}, true
+	case "PX":
+		if len(argv) < 4 {
+			return nil, false
+		}
+		return []*entry.Entry{newCompatEntry(e.DbId, "PEXPIRE", argv[1], argv[3])}, true
+	case "EXAT":
+		if len(argv) < 4 {
+			return nil, false
+		}
+		return []*entry.Entry{newCompatEntry(e.DbId, "EXPIREAT", argv[1], argv[3])}, true
+	case "PXAT":
+		if len(argv) < 4 {
+			return nil, false
+		}
+		return []*entry.Entry{newCompatEntry(e.DbId, "PEXPIREAT", argv[1], argv[3])}, true
+	}
+	return nil, false
+}
+
+// downgradeMPop converts [B]LMPOP and [B]ZMPOP. The blocking variants carry
+// a leading timeout argument that is not needed once the command is replayed.
+func downgradeMPop(e *entry.Entry) ([]*entry.Entry, bool) {
+	argv := e.Argv
+	numkeysIdx := 1
+	if strings.HasPrefix(e.CmdName, "B") {
+		numkeysIdx = 2
+	}
+	if len(argv) <= numkeysIdx {
+		return nil, false
+	}
+	numkeys, err := strconv.Atoi(argv[numkeysIdx])
+	if err != nil || numkeys <= 0 || len(argv) < numkeysIdx+numkeys+2 {
+		return nil, false
+	}
+	keys := argv[numkeysIdx+1 : numkeysIdx+1+numkeys]
+	rest := argv[numkeysIdx+1+numkeys:]
+	count := "1"
+	if len(rest) == 3 && strings.EqualFold(rest[1], "COUNT") {
+		count = rest[2]
+	} else if len(rest) != 1 {
+		return nil, false
+	}
+	var cmd, script string
+	switch strings.ToUpper(rest[0]) {
+	case "LEFT":
+		cmd, script = "LPOP", scriptLMPop
+	case "RIGHT":
+		cmd, script = "RPOP", scriptLMPop
+	case "MIN":
+		cmd, script = "ZPOPMIN", scriptZMPop
+	case "MAX":
+		cmd, script = "ZPOPMAX", scriptZMPop
+	default:
+		return nil, false
+	}
+	return []*entry.Entry{newEvalEntry(e.DbId, script, keys, cmd, count)}, true
+}
+
+// downgradeExpire handles the NX, XX, GT and LT options of the EXPIRE family.
+func downgradeExpire(e *entry.Entry) ([]*entry.Entry, bool) {
+	argv := e.Argv
+	value, err := strconv.ParseInt(argv[2], 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	switch e.CmdName {
+	case "EXPIRE":
+		value *= 1000
+	case "EXPIREAT":
+		value = value*1000 - time.Now().UnixMilli()
+	case "PEXPIREAT":
+		value -= time.Now().UnixMilli()
+	}
+	args := append([]string{strconv.FormatInt(value, 10)}, argv[3:]...)
+	return []*entry.Entry{newEvalEntry(e.DbId, scriptExpireWithOptions, argv[1:2], args...)}, true
+}
+
+// downgradeXTrimOptions removes the LIMIT clause of XADD and XTRIM, which only
+// applies to approximate trimming, and emulates NOMKSTREAM by a Lua script.
+// MINID has no equivalent: XADD is written without trimming, XTRIM can not be
+// downgraded.
+//
+//	XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] id field value ...
+//	XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func downgradeXTrimOptions(e *entry.Entry) ([]*entry.Entry, bool) {
+	argv := e.Argv
+	if len(argv) < 4 {
+		return []*entry.Entry{e}, true
+	}
+	noMkStream := e.CmdName == "XADD" && strings.EqualFold(argv[2], "NOMKSTREAM")
+	newArgv := append([]string{}, argv[:2]...)
+	inx := 2
+	if noMkStream {
+		inx++
+	}
+	switch strings.ToUpper(argv[inx]) {
+	case "MAXLEN", "MINID":
+		clause := inx
+		inx++
+		if inx < len(argv) && (argv[inx] == "=" || argv[inx] == "~") {
+			inx++
+		}
+		inx++ // threshold
+		if inx+1 < len(argv) && strings.EqualFold(argv[inx], "LIMIT") {
+			newArgv = append(newArgv, argv[clause:inx]...)
+			inx += 2
+		} else {
+			newArgv = append(newArgv, argv[clause:min(inx, len(argv))]...)
+		}
+		if strings.EqualFold(argv[clause], "MINID") {
+			if e.CmdName == "XTRIM" {
+				return nil, false
+			}
+			newArgv = newArgv[:2]
+			xaddMinIdWarned.Do(func() {
+				logger.Warnf("XADD with MINID is written without trimming, the target does not support MINID. cmd=[%s]", e.String())
+			})
+		}
+	}
+	newArgv = append(newArgv, argv[min(inx, len(argv)):]...)
+	if noMkStream {
+		return []*entry.Entry{newEvalEntry(e.DbId, scriptXAddNoMkStream, newArgv[1:2], newArgv[2:]...)}, true
+	}
+	return []*entry.Entry{newCompatEntry(e.DbId, newArgv...)}, true
+}
+
+var xaddMinIdWarned sync.Once
+
+func newCompatEntry(dbId int, argv ...string) *entry.Entry {
+	e := entry.NewEntry()
+	e.DbId = dbId
+	e.Argv = argv
+	e.Parse()
+	return e
+}
+
+func newEvalEntry(dbId int, script string, keys []string, args ...string) *entry.Entry {
+	argv := []string{"EVAL", script, strconv.Itoa(len(keys))}
+	argv = append(argv, keys...)
+	argv = append(argv, args...)
+	return newCompatEntry(dbId, argv...)
+}
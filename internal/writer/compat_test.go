@@ -0,0 +1,114 @@
+package writer
+
+import (
+	"strings"
+	"testing"
+
+	"RedisShake/internal/client"
+	"RedisShake/internal/entry"
+)
+
+func testDowngrade(t *testing.T, version int, argv []string) []*entry.Entry {
+	e := entry.NewEntry()
+	e.Argv = argv
+	e.Parse()
+	entries, ok := downgradeEntry(e, version)
+	if !ok {
+		t.Fatalf("downgradeEntry(%v) failed", argv)
+	}
+	return entries
+}
+
+func TestDowngradeEntry(t *testing.T) {
+	// no downgrade for new targets
+	entries := testDowngrade(t, 70200, []string{"LMPOP", "1", "list", "LEFT"})
+	if len(entries) != 1 || entries[0].CmdName != "LMPOP" {
+		t.Errorf("LMPOP should not be downgraded for 7.2, got %v", entries)
+	}
+
+	// SET ... GET
+	entries = testDowngrade(t, 60000, []string{"SET", "key", "value", "NX", "GET"})
+	if strings.Join(entries[0].Argv, " ") != "SET key value NX" {
+		t.Errorf("SET with GET downgrade failed. argv=%v", entries[0].Argv)
+	}
+
+	// SET ... KEEPTTL
+	entries = testDowngrade(t, 60000, []string{"SET", "key", "value", "KEEPTTL"})
+	if strings.Join(entries[0].Argv, " ") != "SET key value KEEPTTL" {
+		t.Errorf("SET with KEEPTTL should be kept for 6.0. argv=%v", entries[0].Argv)
+	}
+	entries = testDowngrade(t, 50000, []string{"SET", "key", "value", "KEEPTTL"})
+	if entries[0].CmdName != "EVAL" || entries[0].Keys[0] != "key" {
+		t.Errorf("SET with KEEPTTL downgrade failed. argv=%v", entries[0].Argv)
+	}
+
+	// LMPOP
+	entries = testDowngrade(t, 60200, []string{"LMPOP", "2", "{a}1", "{a}2", "RIGHT", "COUNT", "3"})
+	if entries[0].CmdName != "EVAL" || len(entries[0].Keys) != 2 || entries[0].Argv[len(entries[0].Argv)-2] != "RPOP" {
+		t.Errorf("LMPOP downgrade failed. argv=%v", entries[0].Argv)
+	}
+
+	// LMOVE
+	entries = testDowngrade(t, 60000, []string{"LMOVE", "src", "dst", "RIGHT", "LEFT"})
+	if strings.Join(entries[0].Argv, " ") != "RPOPLPUSH src dst" {
+		t.Errorf("LMOVE downgrade failed. argv=%v", entries[0].Argv)
+	}
+
+	// XSETID
+	entries = testDowngrade(t, 60200, []string{"XSETID", "stream", "1-1", "ENTRIESADDED", "3", "MAXDELETEDID", "0-1"})
+	if strings.Join(entries[0].Argv, " ") != "XSETID stream 1-1" {
+		t.Errorf("XSETID downgrade failed. argv=%v", entries[0].Argv)
+	}
+
+	// EXPIRE ... NX
+	entries = testDowngrade(t, 60200, []string{"EXPIRE", "key", "10", "NX"})
+	if entries[0].CmdName != "EVAL" || entries[0].Argv[len(entries[0].Argv)-2] != "10000" {
+		t.Errorf("EXPIRE with NX downgrade failed. argv=%v", entries[0].Argv)
+	}
+
+	// COPY
+	entries = testDowngrade(t, 60000, []string{"COPY", "src", "dst", "REPLACE"})
+	if entries[0].CmdName != "EVAL" || len(entries[0].Keys) != 2 {
+		t.Errorf("COPY downgrade failed. argv=%v", entries[0].Argv)
+	}
+
+	// XADD ... LIMIT
+	entries = testDowngrade(t, 60000, []string{"XADD", "stream", "MAXLEN", "~", "100", "LIMIT", "10", "*", "LIMIT", "v"})
+	if strings.Join(entries[0].Argv, " ") != "XADD stream MAXLEN ~ 100 * LIMIT v" {
+		t.Errorf("XADD with LIMIT downgrade failed. argv=%v", entries[0].Argv)
+	}
+	entries = testDowngrade(t, 60000, []string{"XADD", "stream", "NOMKSTREAM", "MAXLEN", "100", "*", "f", "v"})
+	if entries[0].CmdName != "EVAL" || strings.Join(entries[0].Argv[3:], " ") != "stream MAXLEN 100 * f v" {
+		t.Errorf("XADD with NOMKSTREAM downgrade failed. argv=%v", entries[0].Argv)
+	}
+	entries = testDowngrade(t, 60000, []string{"XADD", "stream", "MINID", "=", "0-1", "LIMIT", "10", "*", "f", "v"})
+	if strings.Join(entries[0].Argv, " ") != "XADD stream * f v" {
+		t.Errorf("XADD with MINID should be written without trimming. argv=%v", entries[0].Argv)
+	}
+
+	// incompatible
+	e := entry.NewEntry()
+	e.Argv = []string{"FUNCTION", "LOAD", "#!lua name=lib\n"}
+	e.Parse()
+	if _, ok := downgradeEntry(e, 60200); ok {
+		t.Errorf("FUNCTION LOAD should not be downgraded")
+	}
+	e = entry.NewEntry()
+	e.Argv = []string{"XTRIM", "stream", "MINID", "0-1"}
+	e.Parse()
+	if _, ok := downgradeEntry(e, 60000); ok {
+		t.Errorf("XTRIM with MINID should not be downgraded")
+	}
+}
+
+func TestParseRedisVersion(t *testing.T) {
+	if v := client.ParseRedisVersion("6.2.14"); v != 60214 {
+		t.Errorf("ParseRedisVersion(6.2.14) = %d", v)
+	}
+	if v := client.ParseRedisVersion("7.0"); v != 70000 {
+		t.Errorf("ParseRedisVersion(7.0) = %d", v)
+	}
+	if v := client.ParseRedisVersion("unknown"); v != 0 {
+		t.Errorf("ParseRedisVersion(unknown) = %d", v)
+	}
+}
@@ -2,10 +2,13 @@ package writer
 
 import (
 	"RedisShake/internal/entry"
+	"RedisShake/internal/log"
 	"RedisShake/internal/status"
 	"context"
 )
 
+var logger = log.Component("writer")
+
 type Writer interface {
 	status.Statusable
 	Write(entry *entry.Entry)
@@ -5,7 +5,7 @@ import (
 	"sync"
 
 	"RedisShake/internal/entry"
-	"RedisShake/internal/log"
+	"RedisShake/internal/status"
 	"RedisShake/internal/utils"
 )
 
@@ -24,7 +24,7 @@ func NewRedisClusterWriter(ctx context.Context, opts *RedisWriterOptions) Writer
 	rw := new(RedisClusterWriter)
 	rw.loadClusterNodes(ctx, opts)
 	rw.ch = make(chan *entry.Entry, 1024)
-	log.Infof("redisClusterWriter connected to redis cluster successful. addresses=%v", rw.addresses)
+	logger.Infof("redisClusterWriter connected to redis cluster successful. addresses=%v", rw.addresses)
 	return rw
 }
 
@@ -46,7 +46,7 @@ func (r *RedisClusterWriter) loadClusterNodes(ctx context.Context, opts *RedisWr
 		r.writers = append(r.writers, redisWriter)
 		for _, s := range slots[i] {
 			if r.router[s] != nil {
-				log.Panicf("redisClusterWriter: slot %d already occupied", s)
+				logger.Panicf("redisClusterWriter: slot %d already occupied", s)
 			}
 			r.router[s] = redisWriter
 		}
@@ -54,22 +54,15 @@ func (r *RedisClusterWriter) loadClusterNodes(ctx context.Context, opts *RedisWr
 
 	for i := 0; i < KeySlots; i++ {
 		if r.router[i] == nil {
-			log.Panicf("redisClusterWriter: slot %d not occupied", i)
+			logger.Panicf("redisClusterWriter: slot %d not occupied", i)
 		}
 	}
 }
 
 func (r *RedisClusterWriter) StartWrite(ctx context.Context) chan *entry.Entry {
-	chs := make(map[string]chan *entry.Entry, len(r.writers))
 	for _, w := range r.writers {
-		stat := w.Status().(struct {
-			Name              string `json:"name"`
-			UnansweredBytes   int64  `json:"unanswered_bytes"`
-			UnansweredEntries int64  `json:"unanswered_entries"`
-		})
-		chs[stat.Name] = w.StartWrite(ctx)
+		w.StartWrite(ctx)
 	}
-
 	return nil
 }
 
@@ -86,7 +79,7 @@ func (r *RedisClusterWriter) Write(entry *entry.Entry) {
 			lastSlot = slot
 		}
 		if slot != lastSlot {
-			log.Panicf("CROSSSLOT Keys in request don't hash to the same slot. argv=%v", entry.Argv)
+			logger.Panicf("CROSSSLOT Keys in request don't hash to the same slot. argv=%v", entry.Argv)
 		}
 	}
 	r.router[lastSlot].Write(entry)
@@ -109,6 +102,14 @@ func (r *RedisClusterWriter) Status() interface{} {
 	return r.stat
 }
 
+func (r *RedisClusterWriter) Metrics() []status.Metric {
+	return status.CollectMetrics(r.writers)
+}
+
+func (r *RedisClusterWriter) Healthy() error {
+	return status.CheckHealthy(r.writers)
+}
+
 func (r *RedisClusterWriter) StatusString() string {
 	return "[redis_cluster_writer] writing to redis cluster"
 }
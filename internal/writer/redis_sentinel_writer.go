@@ -2,7 +2,6 @@ package writer
 
 import (
 	"RedisShake/internal/client"
-	"RedisShake/internal/log"
 	"context"
 	"fmt"
 )
@@ -12,7 +11,7 @@ func NewRedisSentinelWriter(ctx context.Context, opts *RedisWriterOptions) Write
 	sentinel.Send("SENTINEL", "GET-MASTER-ADDR-BY-NAME", opts.Master)
 	addr, err := sentinel.Receive()
 	if err != nil {
-		log.Panicf(err.Error())
+		logger.Panicf(err.Error())
 	}
 	hostport := addr.([]interface{})
 	address := fmt.Sprintf("%s:%s", hostport[0].(string), hostport[1].(string))
@@ -25,6 +24,6 @@ func NewRedisSentinelWriter(ctx context.Context, opts *RedisWriterOptions) Write
 		Tls:      opts.Tls,
 		OffReply: opts.OffReply,
 	}
-	log.Infof("connecting to master node at %s", redisOpt.Address)
+	logger.Infof("connecting to master node at %s", redisOpt.Address)
 	return NewRedisStandaloneWriter(ctx, redisOpt)
 }
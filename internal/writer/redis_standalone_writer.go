@@ -14,7 +14,8 @@ import (
 	"RedisShake/internal/client/proto"
 	"RedisShake/internal/config"
 	"RedisShake/internal/entry"
-	"RedisShake/internal/log"
+	"RedisShake/internal/status"
+	"RedisShake/internal/utils"
 )
 
 type RedisWriterOptions struct {
@@ -28,21 +29,38 @@ type RedisWriterOptions struct {
 	OffReply bool   `mapstructure:"off_reply" default:"false"`
 }
 
+// writerCommands are the names of fake entries pushed to chWaitReply for the
+// commands sent by the writer itself, they are not counted in stat.
+var writerCommands = map[string]bool{"select": true, "multi": true, "marker": true, "exec": true}
+
 type redisStandaloneWriter struct {
 	address string
 	client  *client.Redis
 	DbId    int
 
+	// version of the target, used to downgrade commands for old targets
+	version         int
+	incompatible    map[string]int64
+	incompatibleMux sync.Mutex
+
+	// slot served by the target, keyless commands are marked in this slot in
+	// bidirectional sync
+	ownedSlot int
+
 	chWaitReply chan *entry.Entry
 	chWaitWg    sync.WaitGroup
 	offReply    bool
 	ch          chan *entry.Entry
 	chWg        sync.WaitGroup
+	lastReply   int64 // unix nano of the last time a reply is received
 
 	stat struct {
 		Name              string `json:"name"`
 		UnansweredBytes   int64  `json:"unanswered_bytes"`
 		UnansweredEntries int64  `json:"unanswered_entries"`
+
+		TargetVersion       int   `json:"target_version"`
+		IncompatibleEntries int64 `json:"incompatible_entries"` // entries skipped because the target is too old
 	}
 }
 
@@ -52,8 +70,20 @@ func NewRedisStandaloneWriter(ctx context.Context, opts *RedisWriterOptions) Wri
 	rw.stat.Name = "writer_" + strings.Replace(opts.Address, ":", "_", -1)
 	rw.client = client.NewRedisClient(ctx, opts.Address, opts.Username, opts.Password, opts.Tls, false)
 	rw.ch = make(chan *entry.Entry, 1024)
+	rw.version = rw.client.RedisVersion()
+	rw.stat.TargetVersion = rw.version
+	rw.incompatible = make(map[string]int64)
+	rw.lastReply = time.Now().UnixNano()
+	if rw.version == 0 {
+		logger.Infof("[%s] target redis version is unknown, commands will not be downgraded", rw.stat.Name)
+	} else if rw.version < redisVersion700 {
+		logger.Infof("[%s] target redis version is %d, commands introduced later will be downgraded", rw.stat.Name, rw.version)
+	}
+	if config.Opt.Advanced.Bidirectional {
+		rw.ownedSlot = rw.client.OwnedSlot()
+	}
 	if opts.OffReply {
-		log.Infof("turn off the reply of write")
+		logger.Infof("turn off the reply of write")
 		rw.offReply = true
 		rw.client.Send("CLIENT", "REPLY", "OFF")
 	} else {
@@ -71,6 +101,11 @@ func (w *redisStandaloneWriter) Close() {
 		close(w.chWaitReply)
 		w.chWaitWg.Wait()
 	}
+	w.incompatibleMux.Lock()
+	defer w.incompatibleMux.Unlock()
+	for cmd, count := range w.incompatible {
+		logger.Warnf("[%s] skipped incompatible command. cmd=[%s], count=[%d], target_version=[%d]", w.stat.Name, cmd, count, w.version)
+	}
 }
 
 func (w *redisStandaloneWriter) StartWrite(ctx context.Context) chan *entry.Entry {
@@ -87,7 +122,11 @@ func (w *redisStandaloneWriter) StartWrite(ctx context.Context) chan *entry.Entr
 			for e.SerializedSize+atomic.LoadInt64(&w.stat.UnansweredBytes) > config.Opt.Advanced.TargetRedisClientMaxQuerybufLen {
 				time.Sleep(1 * time.Nanosecond)
 			}
-			log.Debugf("[%s] send cmd. cmd=[%s]", w.stat.Name, e.String())
+			logger.Debugf("[%s] send cmd. cmd=[%s]", w.stat.Name, e.String())
+			if config.Opt.Advanced.Bidirectional {
+				w.sendWithLoopMarker(e, bytes)
+				continue
+			}
 			if !w.offReply {
 				w.chWaitReply <- e
 				atomic.AddInt64(&w.stat.UnansweredBytes, e.SerializedSize)
@@ -101,12 +140,56 @@ func (w *redisStandaloneWriter) StartWrite(ctx context.Context) chan *entry.Entr
 	return w.ch
 }
 
+// sendWithLoopMarker sends e in a MULTI/EXEC transaction whose first command
+// sets a marker key in the slot of e. The reader of the opposite direction
+// drops transactions starting with a marker key, so e is not synced back.
+func (w *redisStandaloneWriter) sendWithLoopMarker(e *entry.Entry, bytes []byte) {
+	slot := w.ownedSlot
+	if len(e.Slots) > 0 {
+		slot = e.Slots[0]
+	}
+	multi := &entry.Entry{Argv: []string{"multi"}, CmdName: "multi"}
+	marker := &entry.Entry{Argv: []string{"set", utils.LoopMarkerKey(slot), "1"}, CmdName: "marker"}
+	exec := &entry.Entry{Argv: e.Argv, CmdName: "exec"} // errors of e are replied by EXEC
+	var buf []byte
+	buf = append(buf, multi.Serialize()...)
+	buf = append(buf, marker.Serialize()...)
+	buf = append(buf, bytes...)
+	buf = append(buf, (&entry.Entry{Argv: []string{"exec"}}).Serialize()...)
+	if !w.offReply {
+		w.chWaitReply <- multi
+		w.chWaitReply <- marker
+		w.chWaitReply <- e
+		w.chWaitReply <- exec
+		atomic.AddInt64(&w.stat.UnansweredBytes, e.SerializedSize)
+		atomic.AddInt64(&w.stat.UnansweredEntries, 1)
+	}
+	w.client.SendBytes(buf)
+}
+
 func (w *redisStandaloneWriter) Write(e *entry.Entry) {
-	w.ch <- e
+	entries, ok := downgradeEntry(e, w.version)
+	if !ok {
+		w.reportIncompatible(e)
+		return
+	}
+	for _, theEntry := range entries {
+		w.ch <- theEntry
+	}
+}
+
+func (w *redisStandaloneWriter) reportIncompatible(e *entry.Entry) {
+	atomic.AddInt64(&w.stat.IncompatibleEntries, 1)
+	w.incompatibleMux.Lock()
+	defer w.incompatibleMux.Unlock()
+	if w.incompatible[e.CmdName] == 0 {
+		logger.Warnf("[%s] command can not be downgraded for the target, skip it. target_version=[%d], cmd=[%s]", w.stat.Name, w.version, e.String())
+	}
+	w.incompatible[e.CmdName]++
 }
 
 func (w *redisStandaloneWriter) switchDbTo(newDbId int) {
-	log.Debugf("[%s] switch db to [%d]", w.stat.Name, newDbId)
+	logger.Debugf("[%s] switch db to [%d]", w.stat.Name, newDbId)
 	w.client.Send("select", strconv.Itoa(newDbId))
 	w.DbId = newDbId
 	if !w.offReply {
@@ -120,22 +203,31 @@ func (w *redisStandaloneWriter) switchDbTo(newDbId int) {
 func (w *redisStandaloneWriter) processReply() {
 	for e := range w.chWaitReply {
 		reply, err := w.client.Receive()
-		log.Debugf("[%s] receive reply. reply=[%v], cmd=[%s]", w.stat.Name, reply, e.String())
+		atomic.StoreInt64(&w.lastReply, time.Now().UnixNano())
+		logger.Debugf("[%s] receive reply. reply=[%v], cmd=[%s]", w.stat.Name, reply, e.String())
+		if e.CmdName == "exec" && err == nil {
+			// the last reply of EXEC is the reply of the command
+			if replies, ok := reply.([]interface{}); ok && len(replies) > 0 {
+				if replyErr, ok := replies[len(replies)-1].(proto.RedisError); ok {
+					err = replyErr
+				}
+			}
+		}
 
 		// It's good to skip the nil error since some write commands will return the null reply. For example,
 		// the SET command with NX option will return nil if the key already exists.
 		if err != nil && !errors.Is(err, proto.Nil) {
 			if err.Error() == "BUSYKEY Target key name already exists." {
 				if config.Opt.Advanced.RDBRestoreCommandBehavior == "skip" {
-					log.Debugf("[%s] redisStandaloneWriter received BUSYKEY reply. cmd=[%s]", w.stat.Name, e.String())
+					logger.Debugf("[%s] redisStandaloneWriter received BUSYKEY reply. cmd=[%s]", w.stat.Name, e.String())
 				} else if config.Opt.Advanced.RDBRestoreCommandBehavior == "panic" {
-					log.Panicf("[%s] redisStandaloneWriter received BUSYKEY reply. cmd=[%s]", w.stat.Name, e.String())
+					logger.Panicf("[%s] redisStandaloneWriter received BUSYKEY reply. cmd=[%s]", w.stat.Name, e.String())
 				}
 			} else {
-				log.Panicf("[%s] receive reply failed. cmd=[%s], error=[%v]", w.stat.Name, e.String(), err)
+				logger.Panicf("[%s] receive reply failed. cmd=[%s], error=[%v]", w.stat.Name, e.String(), err)
 			}
 		}
-		if strings.EqualFold(e.CmdName, "select") { // skip select command
+		if writerCommands[e.CmdName] { // skip commands sent by the writer itself
 			continue
 		}
 		atomic.AddInt64(&w.stat.UnansweredBytes, -e.SerializedSize)
@@ -148,6 +240,29 @@ func (w *redisStandaloneWriter) Status() interface{} {
 	return w.stat
 }
 
+func (w *redisStandaloneWriter) Metrics() []status.Metric {
+	name := w.stat.Name
+	return []status.Metric{
+		status.Gauge("redis_shake_writer_unanswered_bytes", "Bytes sent to the destination and not answered yet.", float64(atomic.LoadInt64(&w.stat.UnansweredBytes)), "name", name),
+		status.Gauge("redis_shake_writer_unanswered_entries", "Entries sent to the destination and not answered yet.", float64(atomic.LoadInt64(&w.stat.UnansweredEntries)), "name", name),
+		status.Counter("redis_shake_writer_incompatible_entries_total", "Entries skipped because the destination is too old.", float64(atomic.LoadInt64(&w.stat.IncompatibleEntries)), "name", name),
+	}
+}
+
+// Healthy fails when entries wait for their replies and no reply is received
+// for health_timeout seconds. The writer sends no keepalive of its own, but
+// main writes a PING entry every second, which is forwarded to the target like
+// any other entry, so replies keep coming from a healthy target even when the
+// source is idle.
+func (w *redisStandaloneWriter) Healthy() error {
+	timeout := time.Duration(config.Opt.Advanced.HealthTimeout) * time.Second
+	silent := time.Since(time.Unix(0, atomic.LoadInt64(&w.lastReply)))
+	if timeout > 0 && atomic.LoadInt64(&w.stat.UnansweredEntries) > 0 && silent > timeout {
+		return fmt.Errorf("[%s] received no reply from the target for %.0fs", w.stat.Name, silent.Seconds())
+	}
+	return nil
+}
+
 func (w *redisStandaloneWriter) StatusString() string {
 	return fmt.Sprintf("[%s]: unanswered_entries=%d", w.stat.Name, atomic.LoadInt64(&w.stat.UnansweredEntries))
 }
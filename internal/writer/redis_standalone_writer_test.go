@@ -0,0 +1,102 @@
+package writer
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"RedisShake/internal/client"
+	"RedisShake/internal/client/proto"
+	"RedisShake/internal/commands"
+	"RedisShake/internal/config"
+	"RedisShake/internal/entry"
+	"RedisShake/internal/utils"
+)
+
+// fakeServer answers the handshake of client.NewRedisClient, then sends the
+// other commands received to the returned channel without replying.
+func fakeServer(t *testing.T) (string, chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+	received := make(chan string, 16)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rd := proto.NewReader(bufio.NewReader(conn))
+		for {
+			reply, err := rd.ReadReply()
+			if err != nil {
+				return
+			}
+			argv := client.ArrayString(reply, nil)
+			switch strings.ToLower(argv[0]) {
+			case "ping":
+				_, _ = conn.Write([]byte("+PONG\r\n"))
+			case "info":
+				_, _ = conn.Write([]byte("$11\r\nrole:master\r\n"))
+			default:
+				received <- strings.Join(argv, " ")
+			}
+		}
+	}()
+	return ln.Addr().String(), received
+}
+
+func TestSendWithLoopMarker(t *testing.T) {
+	config.Opt.Advanced.Bidirectional = true
+	config.Opt.Advanced.BidirectionalMarker = "redis-shake:loop:"
+	defer func() { config.Opt.Advanced.Bidirectional = false }()
+
+	address, received := fakeServer(t)
+	w := &redisStandaloneWriter{
+		client:      client.NewRedisClient(context.Background(), address, "", "", false, false),
+		ownedSlot:   100,
+		chWaitReply: make(chan *entry.Entry, 16),
+	}
+	defer w.client.Close()
+
+	for _, argv := range [][]string{{"SET", "key", "v"}, {"FLUSHDB"}} {
+		e := entry.NewEntry()
+		e.Argv = argv
+		e.Parse()
+		w.sendWithLoopMarker(e, e.Serialize())
+
+		slot := w.ownedSlot // keyless commands are marked in the slot of the target
+		if len(e.Slots) > 0 {
+			slot = e.Slots[0]
+		}
+		marker := utils.LoopMarkerKey(slot)
+		want := []string{"multi", "set " + marker + " 1", strings.Join(argv, " "), "exec"}
+		var got []string
+		for range want {
+			got = append(got, <-received)
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("sent %q, want %q", got, want)
+		}
+		if !utils.IsLoopMarkerKey(marker) || commands.CalcSlots([]string{marker})[0] != slot {
+			t.Errorf("marker %s is not a marker key in slot %d", marker, slot)
+		}
+
+		// one reply is expected for each command, EXEC carries the error of e
+		var names []string
+		for range want {
+			names = append(names, (<-w.chWaitReply).CmdName)
+		}
+		if !slices.Equal(names, []string{"multi", "marker", e.CmdName, "exec"}) {
+			t.Errorf("replies waited for %q", names)
+		}
+	}
+	if w.stat.UnansweredEntries != 2 {
+		t.Errorf("unanswered entries = %d, want 2", w.stat.UnansweredEntries)
+	}
+}